@@ -0,0 +1,251 @@
+package gotickfile
+
+import (
+	"fmt"
+	"github.com/melaurent/kafero"
+	"io"
+	"reflect"
+	"sort"
+	"unsafe"
+)
+
+// Number of ticks decoded at once by a Reader
+const readerChunkSize = 4096
+
+// Maximum number of bytes of an encoded tick
+const maxTickBytes = 8
+
+// Reader reads a file without holding its ticks in memory. The ticks are
+// decoded by chunks when needed, starting from a sparse index of the
+// decoder state before each chunk, and the items are read from the file.
+// The index is built as the chunks are decoded, so opening a file does not
+// decode its ticks.
+type Reader struct {
+	tf         *TickFile
+	tickOffset int64
+	tickSize   int64
+	// Decoder state before the first tick of the chunks decoded so far and
+	// of the chunk after them, and the first tick of the chunks decoded
+	index  []tickState
+	firsts []uint64
+	// Last decoded chunk
+	chunk  int
+	ticks  []uint64
+	buffer []byte
+}
+
+func OpenReader(file kafero.File, dataType reflect.Type) (*Reader, error) {
+	tf, err := OpenHeader(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file header: %w", err)
+	}
+	tf.dataType = dataType
+	if err := tf.checkDataType(); err != nil {
+		return nil, fmt.Errorf("error checking data type: %w", err)
+	}
+
+	fstat, err := tf.file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error getting file info: %w", err)
+	}
+	r := &Reader{
+		tf:         tf,
+		tickOffset: tf.header.ItemEnd,
+		tickSize:   fstat.Size() - tf.header.ItemEnd,
+		index:      []tickState{{count: 8}},
+		ticks:      make([]uint64, readerChunkSize),
+		chunk:      -1,
+	}
+
+	return r, nil
+}
+
+// chunkCount returns the number of chunks of the file
+func (r *Reader) chunkCount() int {
+	return (r.tf.itemCount + readerChunkSize - 1) / readerChunkSize
+}
+
+func (r *Reader) chunkLen(chunk int) int {
+	n := r.tf.itemCount - chunk*readerChunkSize
+	if n > readerChunkSize {
+		n = readerChunkSize
+	}
+	return n
+}
+
+// decodeChunk decodes n ticks in r.ticks from the state
+func (r *Reader) decodeChunk(st tickState, n int) (tickState, error) {
+	size := int64(n*maxTickBytes + 1)
+	if size > r.tickSize-st.off {
+		size = r.tickSize - st.off
+	}
+	if size < 0 {
+		return st, io.ErrUnexpectedEOF
+	}
+	if int64(len(r.buffer)) < size {
+		r.buffer = make([]byte, size)
+	}
+	buffer := r.buffer[:size]
+	if c, err := r.tf.file.ReadAt(buffer, r.tickOffset+st.off); err != nil && !(err == io.EOF && c == len(buffer)) {
+		return st, err
+	}
+	if cap(r.ticks) < n {
+		r.ticks = make([]uint64, readerChunkSize)
+	}
+	r.ticks = r.ticks[:n]
+	return decodeTicks(buffer, st, r.ticks)
+}
+
+func (r *Reader) loadChunk(chunk int) error {
+	if chunk == r.chunk {
+		return nil
+	}
+	// The state before a chunk is known once the chunks before it are
+	// decoded
+	for len(r.index) <= chunk {
+		if err := r.decodeIndexed(len(r.index) - 1); err != nil {
+			return err
+		}
+	}
+	return r.decodeIndexed(chunk)
+}
+
+// decodeIndexed decodes a chunk of the index, indexing the chunk after it
+// if it is the last one indexed
+func (r *Reader) decodeIndexed(chunk int) error {
+	if chunk == r.chunk {
+		return nil
+	}
+	r.chunk = -1
+	st, err := r.decodeChunk(r.index[chunk], r.chunkLen(chunk))
+	if err != nil {
+		return err
+	}
+	r.chunk = chunk
+	if chunk == len(r.index)-1 && chunk+1 < r.chunkCount() {
+		r.index = append(r.index, st)
+	}
+	if chunk == len(r.firsts) {
+		r.firsts = append(r.firsts, r.ticks[0])
+	}
+	return nil
+}
+
+func (r *Reader) ItemCount() int {
+	return r.tf.itemCount
+}
+
+// Tick returns the tick of the item at idx
+func (r *Reader) Tick(idx int) (uint64, error) {
+	if idx < 0 || idx >= r.tf.itemCount {
+		return 0, io.EOF
+	}
+	if err := r.loadChunk(idx / readerChunkSize); err != nil {
+		return 0, err
+	}
+	return r.ticks[idx%readerChunkSize], nil
+}
+
+// Search returns the index of the first item with a tick greater or equal
+// to tick, or ItemCount if there is none
+func (r *Reader) Search(tick uint64) (int, error) {
+	// The chunks are decoded up to the first one starting at or after the
+	// tick
+	for n := len(r.firsts); n < r.chunkCount() && (n == 0 || r.firsts[n-1] < tick); n = len(r.firsts) {
+		if err := r.loadChunk(n); err != nil {
+			return 0, err
+		}
+	}
+	chunk := sort.Search(len(r.firsts), func(i int) bool {
+		return r.firsts[i] >= tick
+	})
+	if chunk == 0 {
+		return 0, nil
+	}
+	// The item is in the previous chunk, or is the first of this one
+	chunk -= 1
+	if err := r.loadChunk(chunk); err != nil {
+		return 0, err
+	}
+	idx := sort.Search(len(r.ticks), func(i int) bool {
+		return r.ticks[i] >= tick
+	})
+	return chunk*readerChunkSize + idx, nil
+}
+
+// readItems reads n items from idx in ptr
+func (r *Reader) readItems(idx, n int, ptr unsafe.Pointer) error {
+	size := n * int(r.tf.itemSection.Info.ItemSize)
+	b := (*[1 << 30]byte)(ptr)[:size:size]
+	offset := r.tf.header.ItemStart + int64(idx)*int64(r.tf.itemSection.Info.ItemSize)
+	if c, err := r.tf.file.ReadAt(b, offset); err != nil && !(err == io.EOF && c == size) {
+		return err
+	}
+	return nil
+}
+
+func (r *Reader) ReadItem(idx int) (uint64, interface{}, error) {
+	tick, err := r.Tick(idx)
+	if err != nil {
+		return 0, nil, err
+	}
+	val := reflect.New(r.tf.dataType)
+	if err := r.readItems(idx, 1, unsafe.Pointer(val.Pointer())); err != nil {
+		return 0, nil, err
+	}
+	return tick, val.Interface(), nil
+}
+
+// Read returns all the items associated with the tick of the item at idx,
+// as a pointer to a slice
+func (r *Reader) Read(idx int) (int, uint64, interface{}, error) {
+	tick, err := r.Tick(idx)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	itemCount := 1
+	for {
+		next, err := r.Tick(idx + itemCount)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if next != tick {
+			break
+		}
+		itemCount += 1
+	}
+
+	slice := reflect.New(reflect.SliceOf(r.tf.dataType))
+	slice.Elem().Set(reflect.MakeSlice(reflect.SliceOf(r.tf.dataType), itemCount, itemCount))
+	if err := r.readItems(idx, itemCount, unsafe.Pointer(slice.Elem().Pointer())); err != nil {
+		return 0, 0, nil, err
+	}
+	return itemCount, tick, slice.Interface(), nil
+}
+
+func (r *Reader) GetNameValues() map[string]interface{} {
+	return r.tf.GetNameValues()
+}
+
+func (r *Reader) GetTags() map[string]string {
+	return r.tf.GetTags()
+}
+
+func (r *Reader) GetContentDescription() *string {
+	return r.tf.GetContentDescription()
+}
+
+func (r *Reader) GetFile() kafero.File {
+	return r.tf.file
+}
+
+// Close releases the decoded ticks, the file is left open
+func (r *Reader) Close() error {
+	r.ticks = nil
+	r.buffer = nil
+	r.chunk = -1
+	return nil
+}
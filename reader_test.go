@@ -0,0 +1,147 @@
+package gotickfile
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	file, err := fs.Create("reader.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	tf, err := Create(
+		file,
+		WithDataType(reflect.TypeOf(Data{})),
+		WithTags(map[string]string{"tag": "value"}))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+
+	N := 3*readerChunkSize + 100
+	var ticks []uint64
+	var goldenDeltas []Data
+	var tick uint64 = 1000
+	for i := 0; i < N; i++ {
+		switch rand.Intn(4) {
+		case 0:
+			tick += uint64(rand.Int31())
+		case 1:
+			tick += uint64(rand.Intn(100))
+		}
+		delta := Data{Time: uint64(i), Price: uint8(i), Prib: rand.Uint64()}
+		deltas := []Data{delta}
+		if err := tf.Write(tick, &deltas); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+		ticks = append(ticks, tick)
+		goldenDeltas = append(goldenDeltas, delta)
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenReader(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening reader: %v", err)
+	}
+	if r.ItemCount() != N {
+		t.Fatalf("got different item count: %d", r.ItemCount())
+	}
+	// The chunks are only decoded when needed
+	if len(r.index) != 1 || len(r.firsts) != 0 {
+		t.Fatalf("got %d chunks indexed when opening", len(r.index))
+	}
+	if tick, err := r.Tick(readerChunkSize + 1); err != nil || tick != ticks[readerChunkSize+1] {
+		t.Fatalf("got different tick at %d: %d %v", readerChunkSize+1, tick, err)
+	}
+	if len(r.index) != 3 || len(r.firsts) != 2 {
+		t.Fatalf("got %d chunks indexed after reading the second chunk", len(r.index))
+	}
+	if r.GetTags()["tag"] != "value" {
+		t.Fatalf("got different tags: %v", r.GetTags())
+	}
+	for i := 0; i < N; i++ {
+		tick, err := r.Tick(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tick != ticks[i] {
+			t.Fatalf("got different tick at %d: %d %d", i, tick, ticks[i])
+		}
+	}
+
+	for k := 0; k < 1000; k++ {
+		i := rand.Intn(N)
+		tick, val, err := r.ReadItem(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tick != ticks[i] || *val.(*Data) != goldenDeltas[i] {
+			t.Fatalf("got different item at %d", i)
+		}
+
+		// Search the tick of the item, and the tick before
+		for _, tick := range []uint64{ticks[i], ticks[i] - 1} {
+			idx, err := r.Search(tick)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := sort.Search(N, func(j int) bool { return ticks[j] >= tick })
+			if idx != golden {
+				t.Fatalf("got different search result for %d: %d %d", tick, idx, golden)
+			}
+		}
+	}
+	if idx, _ := r.Search(0); idx != 0 {
+		t.Fatalf("got different search result: %d", idx)
+	}
+	if idx, _ := r.Search(ticks[N-1] + 1); idx != N {
+		t.Fatalf("got different search result: %d", idx)
+	}
+
+	for i := 0; i < N; {
+		n, tick, vals, err := r.Read(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slice := *vals.(*[]Data)
+		if len(slice) != n {
+			t.Fatalf("got %d items, was expecting %d", len(slice), n)
+		}
+		for j := 0; j < n; j++ {
+			if tick != ticks[i+j] || slice[j] != goldenDeltas[i+j] {
+				t.Fatalf("got different item at %d", i+j)
+			}
+		}
+		if i+n < N && ticks[i+n] == tick {
+			t.Fatalf("group for tick %d was split", tick)
+		}
+		i += n
+	}
+	if _, _, _, err := r.Read(N); err == nil {
+		t.Fatalf("was expecting EOF")
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Searching decodes the chunks up to the tick
+	r, err = OpenReader(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening reader: %v", err)
+	}
+	tick = ticks[readerChunkSize+1]
+	idx, err := r.Search(tick)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if golden := sort.Search(N, func(j int) bool { return ticks[j] >= tick }); idx != golden {
+		t.Fatalf("got different search result for %d: %d %d", tick, idx, golden)
+	}
+	if len(r.firsts) == r.chunkCount() {
+		t.Fatalf("was expecting the last chunk not to be decoded")
+	}
+}
@@ -51,77 +51,113 @@ func DecompressTicks(bytes []byte, count int) ([]uint64, error) {
 		return nil, nil
 	}
 
-	br := newBReader(bytes)
-
 	ticks := make([]uint64, count)
-	t, err := br.readBits(64)
-	if err != nil {
+	if _, err := decodeTicks(bytes, tickState{count: 8}, ticks); err != nil {
 		return nil, err
 	}
-	ticks[0] = t
 
-	if count == 1 {
-		return ticks, nil
-	}
+	return ticks, nil
+}
 
-	tDelta, err := br.readBits(64)
-	if err != nil {
-		return nil, err
+// tickState is the state of the tick decoder between two ticks, decoding
+// can resume from it
+type tickState struct {
+	// Index of the next tick
+	idx int
+	// Offset of the current byte in the stream, and bits left in it
+	off   int64
+	count uint8
+	// Last tick and last tick delta
+	tick   uint64
+	tDelta uint64
+}
+
+// decodeTicks decodes len(ticks) ticks from data, which holds the stream
+// from the byte st.off, and returns the state after them
+func decodeTicks(data []byte, st tickState, ticks []uint64) (tickState, error) {
+	if len(ticks) == 0 {
+		return st, nil
 	}
-	ticks[1] = ticks[0] + tDelta
+	if len(data) == 0 {
+		return st, io.EOF
+	}
+
+	br := &bstream{stream: data, count: st.count, byte: data[0] << (8 - st.count)}
 
-	for i := 2; i < count; i++ {
-		var d byte
-		for i := 0; i < 4; i++ {
-			d <<= 1
-			bit, err := br.readBit()
+	for i := range ticks {
+		switch st.idx {
+		case 0:
+			t, err := br.readBits(64)
 			if err != nil {
-				panic(err)
+				return st, err
 			}
-			if bit == zero {
-				break
+			st.tick = t
+
+		case 1:
+			tDelta, err := br.readBits(64)
+			if err != nil {
+				return st, err
 			}
-			d |= 1
-		}
+			st.tDelta = tDelta
+			st.tick += tDelta
 
-		var size uint = 0
-		var dod int64 = 0
-
-		switch d {
-		case 0x00:
-			size = 0
-		case 0x02:
-			// read 7 bits
-			size = 7
-		case 0x06:
-			// read 9 bits
-			size = 9
-		case 0x0e:
-			// read 12 bits
-			size = 12
-		case 0x0f:
-			// read 32 bits
-			size = 32
 		default:
-			return nil, fmt.Errorf("unknown size flag: %d", d)
-		}
-		if size != 0 {
-			bits, err := br.readBits(int(size))
-			if err != nil {
-				return nil, err
+			var d byte
+			for i := 0; i < 4; i++ {
+				d <<= 1
+				bit, err := br.readBit()
+				if err != nil {
+					return st, err
+				}
+				if bit == zero {
+					break
+				}
+				d |= 1
 			}
-			if bits > (1 << (size - 1)) {
-				// or something
-				bits = bits - (1 << size)
+
+			var size uint = 0
+			var dod int64 = 0
+
+			switch d {
+			case 0x00:
+				size = 0
+			case 0x02:
+				// read 7 bits
+				size = 7
+			case 0x06:
+				// read 9 bits
+				size = 9
+			case 0x0e:
+				// read 12 bits
+				size = 12
+			case 0x0f:
+				// read 32 bits
+				size = 32
+			default:
+				return st, fmt.Errorf("unknown size flag: %d", d)
+			}
+			if size != 0 {
+				bits, err := br.readBits(int(size))
+				if err != nil {
+					return st, err
+				}
+				if bits > (1 << (size - 1)) {
+					// or something
+					bits = bits - (1 << size)
+				}
+				dod = int64(bits)
 			}
-			dod = int64(bits)
-		}
 
-		tDelta = tDelta + uint64(dod)
-		ticks[i] = ticks[i-1] + tDelta
+			st.tDelta = st.tDelta + uint64(dod)
+			st.tick += st.tDelta
+		}
+		ticks[i] = st.tick
+		st.idx += 1
 	}
 
-	return ticks, nil
+	st.off += int64(len(data) - len(br.stream))
+	st.count = br.count
+	return st, nil
 }
 
 // bstream is a stream of bits
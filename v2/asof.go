@@ -0,0 +1,102 @@
+package gotickfile
+
+import (
+	"io"
+	"unsafe"
+)
+
+// asOfSource is a secondary reader of an as-of join, with its last item at
+// or before the tick of the primary group
+type asOfSource struct {
+	reader *CTickReader
+	size   uintptr
+	last   []byte
+	valid  bool
+	// State of the reader before the group read ahead, and the tick of the
+	// group, if any
+	state    CTickReaderState
+	nextTick uint64
+	peeked   bool
+	done     bool
+}
+
+// AsOfReader joins to each tick group of a primary reader the last item,
+// at or before the tick of the group, of secondary readers. For instance,
+// trades joined to the prevailing quotes.
+type AsOfReader struct {
+	primary     *CTickReader
+	secondaries []*asOfSource
+	joined      []unsafe.Pointer
+}
+
+// AsOfJoin joins the secondary readers to the primary reader. The readers
+// can have different delta types.
+func AsOfJoin(primary *CTickReader, secondaries ...*CTickReader) *AsOfReader {
+	r := &AsOfReader{
+		primary: primary,
+		joined:  make([]unsafe.Pointer, len(secondaries)),
+	}
+	for _, reader := range secondaries {
+		size := reader.DeltaType().Size()
+		r.secondaries = append(r.secondaries, &asOfSource{
+			reader: reader,
+			size:   size,
+			last:   make([]byte, size),
+		})
+	}
+	return r
+}
+
+// advance reads the groups of the source up to tick. The group after tick
+// is read ahead, and the reader is reset to the state before it.
+func (s *asOfSource) advance(tick uint64) error {
+	for !s.done {
+		if s.peeked && s.nextTick > tick {
+			return nil
+		}
+		s.reader.SaveState(&s.state)
+		t, deltas, err := s.reader.Next()
+		if err == io.EOF {
+			s.done = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if t > tick {
+			s.nextTick = t
+			s.peeked = true
+			return s.reader.Reset(s.state)
+		}
+		s.peeked = false
+		if deltas.Len == 0 {
+			continue
+		}
+		ptr := unsafe.Pointer(uintptr(deltas.Pointer) + uintptr(deltas.Len-1)*s.size)
+		copy(s.last, unsafeBytes(ptr, int(s.size)))
+		s.valid = true
+	}
+	return nil
+}
+
+// Next returns the next tick group of the primary reader, and for each
+// secondary reader a pointer to its last item at or before the tick, or
+// nil if it has none. The deltas and the items are valid until the next
+// call.
+func (r *AsOfReader) Next() (uint64, TickDeltas, []unsafe.Pointer, error) {
+	tick, deltas, err := r.primary.Next()
+	if err != nil {
+		return tick, deltas, nil, err
+	}
+	for i, s := range r.secondaries {
+		if err := s.advance(tick); err != nil {
+			return tick, deltas, nil, err
+		}
+		if s.valid {
+			r.joined[i] = unsafe.Pointer(&s.last[0])
+		} else {
+			r.joined[i] = nil
+		}
+	}
+	return tick, deltas, r.joined, nil
+}
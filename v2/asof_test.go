@@ -0,0 +1,249 @@
+package gotickfile
+
+import (
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+type quoteTick struct {
+	tick  uint64
+	quote Quote
+}
+
+// writeQuotes writes random quotes, a few per tick, and returns them
+func writeQuotes(t *testing.T, tf *TickFile, n int) []quoteTick {
+	var quotes []quoteTick
+	var tick uint64 = 0
+	for i := 0; i < n; i++ {
+		tick += uint64(rand.Intn(5))
+		q := Quote{Bid: float64(rand.Intn(1000)), Ask: float64(rand.Intn(1000)), Volume: int32(rand.Intn(100))}
+		if err := tf.Write(tick, TickDeltas{Pointer: unsafe.Pointer(&q), Len: 1}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+		quotes = append(quotes, quoteTick{tick: tick, quote: q})
+	}
+	return quotes
+}
+
+func readGroup(t *testing.T, r *CTickReader) (uint64, []Quote, error) {
+	tick, deltas, err := r.Next()
+	if err != nil {
+		return tick, nil, err
+	}
+	var quotes []Quote
+	for i := 0; i < deltas.Len; i++ {
+		quotes = append(quotes, *(*Quote)(unsafe.Pointer(uintptr(deltas.Pointer) + uintptr(i)*unsafe.Sizeof(Quote{}))))
+	}
+	return tick, quotes, nil
+}
+
+func TestReaderStateReset(t *testing.T) {
+	for _, configs := range [][]TickFileConfig{nil, {WithColumnarLayout(50)}} {
+		tf, err := CreateInMemory(append([]TickFileConfig{WithDataType(reflect.TypeOf(Quote{}))}, configs...)...)
+		if err != nil {
+			t.Fatalf("error creating tickfile: %v", err)
+		}
+		writeQuotes(t, tf, 500)
+		if err := tf.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := r.State()
+		for k := 0; k < 100; k++ {
+			// Read ahead, and read again after a reset
+			state := r.State()
+			var ticks []uint64
+			var groups [][]Quote
+			for i := 0; i < 1+rand.Intn(30); i++ {
+				tick, quotes, err := readGroup(t, r)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				ticks = append(ticks, tick)
+				groups = append(groups, quotes)
+			}
+			if err := r.Reset(state); err != nil {
+				t.Fatal(err)
+			}
+			for i := range ticks {
+				tick, quotes, err := readGroup(t, r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tick != ticks[i] || !reflect.DeepEqual(quotes, groups[i]) {
+					t.Fatalf("got different group after reset: %d %v, %d %v", tick, quotes, ticks[i], groups[i])
+				}
+			}
+			if k%10 == 0 {
+				if err := r.Reset(start); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		// Saving and restoring a state does not allocate
+		var saved CTickReaderState
+		r.SaveState(&saved)
+		allocs := testing.AllocsPerRun(100, func() {
+			r.SaveState(&saved)
+			if err := r.Reset(saved); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs > 0 {
+			t.Fatalf("got %v allocations per state", allocs)
+		}
+	}
+}
+
+func TestReaderResetCorrupted(t *testing.T) {
+	for _, configs := range [][]TickFileConfig{nil, {WithColumnarLayout(50)}} {
+		tf, err := CreateInMemory(append([]TickFileConfig{WithDataType(reflect.TypeOf(Quote{}))}, configs...)...)
+		if err != nil {
+			t.Fatalf("error creating tickfile: %v", err)
+		}
+		writeQuotes(t, tf, 100)
+		if err := tf.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			if _, _, err := readGroup(t, r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		state := r.State()
+		if len(state.cr.dec) > 0 {
+			state.cr.dec = state.cr.dec[:1]
+		} else {
+			state.dec = state.dec[:1]
+		}
+		next := r.State()
+		nextTick, nextQuotes, err := readGroup(t, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Reset(next); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Reset(state); err == nil {
+			t.Fatalf("was expecting an error resetting to a corrupted state")
+		}
+		gotTick, gotQuotes, err := readGroup(t, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The reader is left unchanged
+		if gotTick != nextTick || !reflect.DeepEqual(gotQuotes, nextQuotes) {
+			t.Fatalf("got different group after a failed reset: %d %v, %d %v", gotTick, gotQuotes, nextTick, nextQuotes)
+		}
+	}
+}
+
+func TestAsOfJoin(t *testing.T) {
+	trades, err := CreateInMemory(WithDataType(reflect.TypeOf(Data{})))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	var tradeTicks []uint64
+	var tick uint64 = 0
+	for i := 0; i < 1000; i++ {
+		tick += uint64(rand.Intn(8))
+		delta := Data{Time: uint64(i)}
+		if err := trades.Write(tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+		if n := len(tradeTicks); n == 0 || tradeTicks[n-1] != tick {
+			tradeTicks = append(tradeTicks, tick)
+		}
+	}
+
+	var golden [][]quoteTick
+	var readers []*CTickReader
+	for _, configs := range [][]TickFileConfig{nil, {WithColumnarLayout(50)}} {
+		tf, err := CreateInMemory(append([]TickFileConfig{WithDataType(reflect.TypeOf(Quote{}))}, configs...)...)
+		if err != nil {
+			t.Fatalf("error creating tickfile: %v", err)
+		}
+		golden = append(golden, writeQuotes(t, tf, 1000))
+		if err := tf.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		reader, err := tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		readers = append(readers, reader)
+	}
+	primary, err := trades.GetTickReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states := []CTickReaderState{primary.State()}
+	for _, reader := range readers {
+		states = append(states, reader.State())
+	}
+	// Joining does not allocate
+	r := AsOfJoin(primary, readers...)
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, _, _, err := r.Next(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > 0 {
+		t.Fatalf("got %v allocations per join", allocs)
+	}
+	if err := primary.Reset(states[0]); err != nil {
+		t.Fatal(err)
+	}
+	for i, reader := range readers {
+		if err := reader.Reset(states[i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r = AsOfJoin(primary, readers...)
+	for _, tradeTick := range tradeTicks {
+		tick, deltas, joined, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tick != tradeTick || deltas.Len == 0 {
+			t.Fatalf("got different trade group: %d %d", tick, tradeTick)
+		}
+		for i, quotes := range golden {
+			// Last quote at or before the tick
+			var last *Quote
+			for j := range quotes {
+				if quotes[j].tick > tick {
+					break
+				}
+				last = &quotes[j].quote
+			}
+			if last == nil {
+				if joined[i] != nil {
+					t.Fatalf("was expecting no quote at %d", tick)
+				}
+				continue
+			}
+			if joined[i] == nil || *(*Quote)(joined[i]) != *last {
+				t.Fatalf("got different quote at %d", tick)
+			}
+		}
+	}
+	if _, _, _, err := r.Next(); err != io.EOF {
+		t.Fatalf("was expecting EOF, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package gotickfile
+
+import (
+	"fmt"
+	"time"
+)
+
+// WithAutoFlush flushes the file in the background every interval, and as
+// soon as maxBytes of encoded data are waiting to be written. A zero
+// interval or maxBytes disables the corresponding limit. The background
+// flushes only push the data to the OS, see WithAutoSync.
+func WithAutoFlush(interval time.Duration, maxBytes int) TickFileConfig {
+	return func(tf *TickFile) {
+		if interval < 0 || maxBytes < 0 {
+			panic(fmt.Sprintf("invalid auto flush limits: %s %d", interval, maxBytes))
+		}
+		if tf.autoFlush == nil {
+			tf.autoFlush = &autoFlush{}
+		}
+		tf.autoFlush.interval = interval
+		tf.autoFlush.maxBytes = maxBytes
+	}
+}
+
+// WithAutoSync syncs the file to stable storage on the background flushes
+// if the last sync is older than interval.
+func WithAutoSync(interval time.Duration) TickFileConfig {
+	return func(tf *TickFile) {
+		if interval <= 0 {
+			panic(fmt.Sprintf("invalid auto sync interval: %s", interval))
+		}
+		if tf.autoFlush == nil {
+			tf.autoFlush = &autoFlush{}
+		}
+		tf.autoFlush.syncInterval = interval
+	}
+}
+
+type autoFlush struct {
+	interval     time.Duration
+	maxBytes     int
+	syncInterval time.Duration
+	lastSync     time.Time
+	trigger      chan struct{}
+	done         chan struct{}
+	stopped      chan struct{}
+	// First error of the background flushes, guarded by the file lock
+	err error
+	// Clock and ticker of the background flushes, replaced in tests
+	now       func() time.Time
+	newTicker func(d time.Duration) (<-chan time.Time, func())
+	// Signaled with the result of each background flush, in tests
+	flushed chan<- error
+}
+
+func newTicker(d time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(d)
+	return ticker.C, ticker.Stop
+}
+
+func (tf *TickFile) startAutoFlush() {
+	af := tf.autoFlush
+	if af == nil || (af.interval == 0 && af.maxBytes == 0) {
+		tf.autoFlush = nil
+		return
+	}
+	af.trigger = make(chan struct{}, 1)
+	af.done = make(chan struct{})
+	af.stopped = make(chan struct{})
+	if af.now == nil {
+		af.now = time.Now
+	}
+	if af.newTicker == nil {
+		af.newTicker = newTicker
+	}
+	af.lastSync = af.now()
+	go af.run(tf)
+}
+
+func (af *autoFlush) run(tf *TickFile) {
+	defer close(af.stopped)
+	var tick <-chan time.Time
+	if af.interval > 0 {
+		c, stop := af.newTicker(af.interval)
+		defer stop()
+		tick = c
+	}
+	for {
+		select {
+		case <-af.done:
+			return
+		case <-tick:
+		case <-af.trigger:
+		}
+		tf.Lock()
+		sync := af.syncInterval > 0 && af.now().Sub(af.lastSync) >= af.syncInterval
+		err := tf.flush(sync)
+		if err != nil {
+			if af.err == nil {
+				af.err = err
+			}
+		} else if sync {
+			af.lastSync = af.now()
+		}
+		tf.Unlock()
+		if af.flushed != nil {
+			af.flushed <- err
+		}
+	}
+}
+
+// check triggers a flush if too much data is waiting to be written. The
+// file lock must be held.
+func (af *autoFlush) check(tf *TickFile) {
+	if af.maxBytes == 0 || tf.pendingBytes() < af.maxBytes {
+		return
+	}
+	select {
+	case af.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (af *autoFlush) stop() error {
+	select {
+	case <-af.stopped:
+	default:
+		close(af.done)
+		<-af.stopped
+	}
+	return af.err
+}
+
+// pendingBytes returns the size of the encoded data not flushed yet
+func (tf *TickFile) pendingBytes() int {
+	if tf.blocks != nil {
+		return tf.blocks.rawSize(tf.flushedBlocks) - tf.flushedTail
+	}
+	if tf.block == nil {
+		return 0
+	}
+	tf.block.RLock()
+	defer tf.block.RUnlock()
+	return len(tf.block.Bytes()) - tf.lastWrite
+}
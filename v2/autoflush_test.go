@@ -0,0 +1,131 @@
+package gotickfile
+
+import (
+	"github.com/melaurent/kafero"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// syncCountFile counts the syncs of the file
+type syncCountFile struct {
+	kafero.File
+	syncs int32
+}
+
+func (f *syncCountFile) Sync() error {
+	atomic.AddInt32(&f.syncs, 1)
+	return f.File.Sync()
+}
+
+// withAutoFlushHooks replaces the clock and the ticker of the background
+// flushes, and signals the flushes on flushed
+func withAutoFlushHooks(now func() time.Time, tick <-chan time.Time, flushed chan<- error) TickFileConfig {
+	return func(tf *TickFile) {
+		tf.autoFlush.now = now
+		tf.autoFlush.newTicker = func(time.Duration) (<-chan time.Time, func()) {
+			return tick, func() {}
+		}
+		tf.autoFlush.flushed = flushed
+	}
+}
+
+// checkFlushed checks that the first n items are in the file
+func checkFlushed(t *testing.T, name string, n int, ticks []uint64, goldenDeltas []Data) {
+	rf, err := fs.Open(name)
+	if err != nil {
+		t.Fatalf("error opening file: %v", err)
+	}
+	rtf, err := OpenRead(rf, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	reader, err := rtf.GetTickReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReader(t, reader, ticks[:n], goldenDeltas[:n], func(d Data) Data { return d })
+}
+
+func TestAutoFlush(t *testing.T) {
+	var ticks []uint64
+	var goldenDeltas []Data
+	for i := 0; i < 100; i++ {
+		ticks = append(ticks, uint64(i))
+		goldenDeltas = append(goldenDeltas, Data{Time: uint64(i), Price: uint32(i), Prib: uint64(i * i)})
+	}
+	var clock int64
+	now := func() time.Time {
+		return time.Unix(0, atomic.LoadInt64(&clock))
+	}
+	flushed := make(chan error, 1)
+
+	// Flushes on the ticker, syncing if the last sync is older than 1ms
+	mfile, err := fs.Create("autoflush.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	file := &syncCountFile{File: mfile}
+	tickC := make(chan time.Time)
+	tf, err := Create(file,
+		WithDataType(reflect.TypeOf(Data{})),
+		WithAutoFlush(time.Hour, 0),
+		WithAutoSync(time.Millisecond),
+		withAutoFlushHooks(now, tickC, flushed))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	for k, n := range []int{50, 100} {
+		for i := n - 50; i < n; i++ {
+			if err := tf.Write(ticks[i], TickDeltas{Pointer: unsafe.Pointer(&goldenDeltas[i]), Len: 1}); err != nil {
+				t.Fatalf("error writing: %v", err)
+			}
+		}
+		checkFlushed(t, "autoflush.tick", n-50, ticks, goldenDeltas)
+		tickC <- time.Time{}
+		if err := <-flushed; err != nil {
+			t.Fatalf("error flushing: %v", err)
+		}
+		checkFlushed(t, "autoflush.tick", n, ticks, goldenDeltas)
+		if syncs := atomic.LoadInt32(&file.syncs); syncs != int32(k) {
+			t.Fatalf("got %d syncs, was expecting %d", syncs, k)
+		}
+		atomic.AddInt64(&clock, int64(2*time.Millisecond))
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flushes past 64 bytes waiting to be written
+	for _, configs := range [][]TickFileConfig{nil, {WithColumnarLayout(8)}} {
+		file, err := fs.Create("autoflush.tick")
+		if err != nil {
+			t.Fatalf("error creating file")
+		}
+		configs = append([]TickFileConfig{WithDataType(reflect.TypeOf(Data{})), WithAutoFlush(0, 64)}, configs...)
+		tf, err := Create(file, append(configs, withAutoFlushHooks(now, nil, flushed))...)
+		if err != nil {
+			t.Fatalf("error creating tickfile: %v", err)
+		}
+		groupLens := make([]int, len(ticks))
+		for i := range groupLens {
+			groupLens[i] = 1
+		}
+		// The size is checked once per batch
+		if err := tf.WriteBatch(ticks, TickDeltas{Pointer: unsafe.Pointer(&goldenDeltas[0]), Len: len(goldenDeltas)}, groupLens); err != nil {
+			t.Fatalf("error writing batch: %v", err)
+		}
+		if err := <-flushed; err != nil {
+			t.Fatalf("error flushing: %v", err)
+		}
+		checkFlushed(t, "autoflush.tick", len(ticks), ticks, goldenDeltas)
+		if err := tf.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,1034 @@
+package gotickfile
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/melaurent/gotickfile/v2/compress"
+	"hash/crc32"
+	"io"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// In the columnar layout, the item area is a sequence of blocks.
+// Each block starts with a header:
+// ItemCount      uint32
+// FirstTick      uint64
+// LastTick       uint64
+// ColumnCount    uint32
+// ColumnSizes    [ColumnCount]uint32
+// ColumnRawSizes [ColumnCount]uint32
+// FieldStats     [ColumnCount-1]{Min uint64, Max uint64, Count uint32}
+// followed by the column streams, the tick stream first and then one
+// stream per item section field, and by the CRC-32 (Castagnoli) of the
+// block as a uint32. Every stream of a block starts with a raw value so a
+// block can be decoded without the blocks before it.
+// A group of items sharing the same tick never spans two blocks.
+// Each column is compressed on its own with the block compression of the
+// block section, a column whose size is its raw size is stored as is.
+// The field stats hold the min and max of the numeric fields, encoded
+// with encodeNumber, and the count of values that are not NaN.
+// The last block is rewritten in place by the flushes until the next
+// block is started, the checksum detects a rewrite torn by a crash. Before
+// the rewrite, the version of the last block written by the previous
+// flush is appended after the end of the new blocks, followed by its
+// uint32 size, and it is truncated away once the new blocks are written.
+// When the last block is torn, it is restored from that copy.
+
+var blockCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+type columnBlock struct {
+	// Held for writing while the tail is encoded, and for reading while
+	// its columns are decoded
+	sync.RWMutex
+	offset    int64
+	size      int64
+	itemCount int
+	firstTick uint64
+	lastTick  uint64
+	columns   []*compress.BBuffer
+	stats     []fieldStats
+	// Columns not decompressed yet
+	codec    uint8
+	packed   [][]byte
+	rawSizes []int
+	// Bytes and checksum of a block read from a file, until checked
+	unchecked []byte
+	crc       uint32
+	// Encoded block waiting to be written
+	encoded []byte
+}
+
+type fieldStats struct {
+	min   uint64
+	max   uint64
+	count uint32
+}
+
+func newColumnBlock(offset int64, info *ItemSection) *columnBlock {
+	b := &columnBlock{
+		offset:  offset,
+		columns: make([]*compress.BBuffer, len(info.Fields)+1),
+		stats:   make([]fieldStats, len(info.Fields)),
+	}
+	for i := range b.columns {
+		b.columns[i] = compress.NewBBuffer(nil, 0)
+	}
+	return b
+}
+
+func blockHeaderSize(columnCount int) int64 {
+	return 4 + 8 + 8 + 4 + 8*int64(columnCount) + 20*int64(columnCount-1)
+}
+
+func (b *columnBlock) updateStats(info *ItemSection, ptr unsafe.Pointer) {
+	for i, f := range info.Fields {
+		n, ok := fieldNumber(f.Type, unsafe.Pointer(uintptr(ptr)+uintptr(f.Offset)))
+		if !ok || n.isNaN() {
+			continue
+		}
+		s := &b.stats[i]
+		if s.count == 0 {
+			s.min = encodeNumber(n)
+			s.max = s.min
+		} else {
+			if c, _ := compareNumbers(n, decodeNumber(f.Type, s.min)); c < 0 {
+				s.min = encodeNumber(n)
+			}
+			if c, _ := compareNumbers(n, decodeNumber(f.Type, s.max)); c > 0 {
+				s.max = encodeNumber(n)
+			}
+		}
+		s.count += 1
+	}
+}
+
+// check verifies the checksum of a block read from a file, the caller
+// holds the lock of the block
+func (b *columnBlock) check() error {
+	if b.unchecked != nil {
+		if crc32.Checksum(b.unchecked, blockCRCTable) != b.crc {
+			return ErrCorruptedBlock
+		}
+		b.unchecked = nil
+	}
+	return nil
+}
+
+// column returns the stream of column i, decompressing it if needed
+func (b *columnBlock) column(i int) (*compress.BBuffer, error) {
+	b.Lock()
+	defer b.Unlock()
+	if err := b.check(); err != nil {
+		return nil, fmt.Errorf("error reading block at offset %d: %w", b.offset, err)
+	}
+	if b.columns[i] == nil {
+		raw, err := compress.DecompressBlock(b.codec, b.packed[i], b.rawSizes[i])
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing column %d: %w", i, err)
+		}
+		b.columns[i] = compress.NewBBuffer(raw, 0)
+		b.packed[i] = nil
+	}
+	return b.columns[i], nil
+}
+
+func (b *columnBlock) encode(order binary.ByteOrder, codec uint8) ([]byte, error) {
+	packed := make([][]byte, len(b.columns))
+	for i, c := range b.columns {
+		var err error
+		packed[i], err = compress.CompressBlock(codec, c.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("error compressing column %d: %w", i, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, order, uint32(b.itemCount)); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buf, order, b.firstTick); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buf, order, b.lastTick); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buf, order, uint32(len(b.columns))); err != nil {
+		return nil, err
+	}
+	for _, p := range packed {
+		if err := binary.Write(&buf, order, uint32(len(p))); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range b.columns {
+		if err := binary.Write(&buf, order, uint32(len(c.Bytes()))); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range b.stats {
+		if err := binary.Write(&buf, order, s.min); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(&buf, order, s.max); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(&buf, order, s.count); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range packed {
+		buf.Write(p)
+	}
+	if err := binary.Write(&buf, order, crc32.Checksum(buf.Bytes(), blockCRCTable)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readColumnBlock decodes the block at the beginning of data. The columns
+// of the returned block point into data and are decompressed on first
+// use, the checksum is verified then. A block cut short by a partial write
+// is reported with ErrCorruptedBlock.
+func readColumnBlock(data []byte, order binary.ByteOrder, columnCount int, codec uint8) (*columnBlock, error) {
+	headerSize := int(blockHeaderSize(columnCount))
+	if len(data) < headerSize {
+		return nil, ErrCorruptedBlock
+	}
+	b := &columnBlock{
+		itemCount: int(order.Uint32(data[0:])),
+		firstTick: order.Uint64(data[4:]),
+		lastTick:  order.Uint64(data[12:]),
+		codec:     codec,
+	}
+	if n := int(order.Uint32(data[20:])); n != columnCount {
+		// The column count is the one of the item section
+		return nil, ErrCorruptedBlock
+	}
+	b.stats = make([]fieldStats, columnCount-1)
+	for i := range b.stats {
+		off := 24 + 8*columnCount + 20*i
+		b.stats[i] = fieldStats{
+			min:   order.Uint64(data[off:]),
+			max:   order.Uint64(data[off+8:]),
+			count: order.Uint32(data[off+16:]),
+		}
+	}
+	offset := headerSize
+	b.columns = make([]*compress.BBuffer, columnCount)
+	b.packed = make([][]byte, columnCount)
+	b.rawSizes = make([]int, columnCount)
+	for i := 0; i < columnCount; i++ {
+		size := int(order.Uint32(data[24+4*i:]))
+		rawSize := int(order.Uint32(data[24+4*columnCount+4*i:]))
+		if offset+size > len(data) {
+			return nil, ErrCorruptedBlock
+		}
+		if size == rawSize {
+			b.columns[i] = compress.NewBBuffer(data[offset:offset+size:offset+size], 0)
+		} else {
+			b.packed[i] = data[offset : offset+size : offset+size]
+			b.rawSizes[i] = rawSize
+		}
+		offset += size
+	}
+	if offset+4 > len(data) {
+		return nil, ErrCorruptedBlock
+	}
+	b.unchecked = data[:offset]
+	b.crc = order.Uint32(data[offset:])
+	b.size = int64(offset + 4)
+	return b, nil
+}
+
+// readColumnBlocks decodes all the blocks of an item area starting at
+// file offset start. Only the checksum of the last block, the one
+// rewritten by the flushes, is verified. If the last block is incomplete,
+// the valid blocks are returned along with ErrCorruptedBlock.
+func readColumnBlocks(data []byte, start int64, order binary.ByteOrder, columnCount int, codec uint8) ([]*columnBlock, error) {
+	var blocks []*columnBlock
+	var offset int64 = 0
+	var err error
+	for offset < int64(len(data)) {
+		var b *columnBlock
+		b, err = readColumnBlock(data[offset:], order, columnCount, codec)
+		if err != nil {
+			break
+		}
+		// The ticks of a block are after the ticks of the previous one,
+		// anything else is a leftover of a rewrite
+		if b.itemCount == 0 || (len(blocks) > 0 && b.firstTick <= blocks[len(blocks)-1].lastTick) {
+			err = ErrCorruptedBlock
+			break
+		}
+		b.offset = start + offset
+		blocks = append(blocks, b)
+		offset += b.size
+	}
+	if n := len(blocks); n > 0 {
+		if cerr := blocks[n-1].check(); cerr != nil {
+			return blocks[:n-1], cerr
+		}
+	}
+	return blocks, err
+}
+
+// readTailFallback returns the previous version of the last block appended
+// at the end of data by an interrupted flush, if it follows the blocks,
+// along with its bytes.
+func readTailFallback(data []byte, blocks []*columnBlock, start int64, order binary.ByteOrder, columnCount int, codec uint8) (*columnBlock, []byte) {
+	if len(data) < 4 {
+		return nil, nil
+	}
+	offset := start
+	if n := len(blocks); n > 0 {
+		offset = blocks[n-1].offset + blocks[n-1].size
+	}
+	size := int64(order.Uint32(data[len(data)-4:]))
+	from := int64(len(data)) - 4 - size
+	if size == 0 || from < offset-start {
+		return nil, nil
+	}
+	raw := data[from : len(data)-4]
+	b, err := readColumnBlock(raw, order, columnCount, codec)
+	if err != nil || b.size != size || b.check() != nil {
+		return nil, nil
+	}
+	if n := len(blocks); n > 0 && b.firstTick <= blocks[n-1].lastTick {
+		return nil, nil
+	}
+	b.offset = offset
+	return b, raw
+}
+
+type columnBlocks struct {
+	sync.RWMutex
+	blocks []*columnBlock
+}
+
+// get returns the block at idx, the number of items readers can decode
+// from it and whether it is the last block.
+func (cb *columnBlocks) get(idx int) (*columnBlock, int, bool) {
+	cb.RLock()
+	defer cb.RUnlock()
+	if idx >= len(cb.blocks) {
+		return nil, 0, true
+	}
+	b := cb.blocks[idx]
+	return b, b.itemCount, idx == len(cb.blocks)-1
+}
+
+func (cb *columnBlocks) tail() *columnBlock {
+	cb.RLock()
+	defer cb.RUnlock()
+	if len(cb.blocks) == 0 {
+		return nil
+	}
+	return cb.blocks[len(cb.blocks)-1]
+}
+
+// rawSize returns the size of the columns of the blocks from idx, before
+// block compression.
+func (cb *columnBlocks) rawSize(idx int) int {
+	cb.RLock()
+	defer cb.RUnlock()
+	n := 0
+	for _, b := range cb.blocks[idx:] {
+		b.RLock()
+		for _, c := range b.columns {
+			n += len(c.Bytes())
+		}
+		b.RUnlock()
+	}
+	return n
+}
+
+func (cb *columnBlocks) len() int {
+	cb.RLock()
+	defer cb.RUnlock()
+	return len(cb.blocks)
+}
+
+type blockWriter struct {
+	tickC   *compress.TickCompress
+	writers []FieldWriter
+}
+
+func newBlockWriter(b *columnBlock, info *ItemSection, tick uint64, ptr unsafe.Pointer) *blockWriter {
+	w := &blockWriter{
+		tickC:   compress.NewTickCompress(b.columns[0], tick),
+		writers: make([]FieldWriter, len(info.Fields)),
+	}
+	for i, f := range info.Fields {
+		fieldPtr := unsafe.Pointer(uintptr(ptr) + uintptr(f.Offset))
+		w.writers[i] = FieldWriter{
+			offset: uintptr(f.Offset),
+			c:      compress.GetCompress(b.columns[i+1], fieldPtr, info.fieldSize(i), f.CompressionVersion),
+		}
+	}
+	return w
+}
+
+func (w *blockWriter) Write(b *columnBlock, tick uint64, ptr unsafe.Pointer) {
+	w.tickC.Compress(b.columns[0], tick)
+	for i, fw := range w.writers {
+		fw.c.Compress(b.columns[i+1], unsafe.Pointer(uintptr(ptr)+fw.offset))
+	}
+}
+
+// blockWriterFromBlock replays a block read from a file to rebuild the
+// compressors state. It returns a copy of the block, trimmed to the last
+// bit written, that can be appended to.
+func blockWriterFromBlock(b *columnBlock, info *ItemSection) (*columnBlock, *blockWriter, error) {
+	nb := &columnBlock{
+		offset:    b.offset,
+		itemCount: b.itemCount,
+		firstTick: b.firstTick,
+		lastTick:  b.lastTick,
+		columns:   make([]*compress.BBuffer, len(b.columns)),
+		stats:     append([]fieldStats(nil), b.stats...),
+	}
+	for i := range b.columns {
+		c, err := b.column(i)
+		if err != nil {
+			return nil, nil, err
+		}
+		nb.columns[i] = compress.NewBBuffer(append([]byte(nil), c.Bytes()...), 0)
+	}
+	w := &blockWriter{
+		writers: make([]FieldWriter, len(info.Fields)),
+	}
+	val := make([]byte, info.Info.ItemSize)
+	ptr := unsafe.Pointer(&val[0])
+
+	br := compress.NewBitReader(nb.columns[0])
+	tickC, _, err := compress.NewTickDecompress(br)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decompressing tick column: %w", err)
+	}
+	for i := 1; i < nb.itemCount; i++ {
+		if _, err := tickC.Decompress(br); err != nil {
+			return nil, nil, fmt.Errorf("error decompressing tick column: %w", err)
+		}
+	}
+	nb.columns[0].RewindTo(br.State())
+	w.tickC = tickC.ToCompress()
+
+	for i, f := range info.Fields {
+		fieldPtr := unsafe.Pointer(uintptr(ptr) + uintptr(f.Offset))
+		br := compress.NewBitReader(nb.columns[i+1])
+		d, err := compress.GetDecompress(br, fieldPtr, info.fieldSize(i), f.CompressionVersion)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decompressing field column: %w", err)
+		}
+		for j := 1; j < nb.itemCount; j++ {
+			if err := d.Decompress(br, fieldPtr); err != nil {
+				return nil, nil, fmt.Errorf("error decompressing field column: %w", err)
+			}
+		}
+		nb.columns[i+1].RewindTo(br.State())
+		w.writers[i] = FieldWriter{
+			offset: uintptr(f.Offset),
+			c:      d.ToCompress(),
+		}
+	}
+
+	return nb, w, nil
+}
+
+// columnReader decodes the selected columns of the blocks, the fields
+// that are not selected are left zeroed in the returned items.
+type columnReader struct {
+	blocks   *columnBlocks
+	skip     func(b *columnBlock) bool
+	info     *ItemSection
+	size     uintptr
+	fields   []int
+	blockIdx int
+	itemIdx  int
+	tick     uint64
+	nextTick uint64
+	pending  bool
+	loaded   bool
+	tickR    *compress.BitReader
+	tickC    *compress.TickDecompress
+	fieldR   []*compress.BitReader
+	fieldC   []compress.Decompress
+	val      []byte
+}
+
+type columnReaderState struct {
+	blockIdx int
+	itemIdx  int
+	tick     uint64
+	nextTick uint64
+	pending  bool
+	// Positions of the tick and field readers, empty if the block was not
+	// loaded
+	bits []compress.BitReaderState
+	// State of the decompressors, empty before the first item of the block
+	dec []byte
+}
+
+func newColumnReader(blocks *columnBlocks, info *ItemSection, size uintptr, fields []int) *columnReader {
+	return &columnReader{
+		blocks: blocks,
+		info:   info,
+		size:   size,
+		fields: fields,
+		fieldR: make([]*compress.BitReader, len(fields)),
+		fieldC: make([]compress.Decompress, len(fields)),
+		val:    make([]byte, size),
+	}
+}
+
+// SaveState saves the state of the reader to state, reusing its memory
+func (r *columnReader) SaveState(state *columnReaderState) {
+	state.blockIdx = r.blockIdx
+	state.itemIdx = r.itemIdx
+	state.tick = r.tick
+	state.nextTick = r.nextTick
+	state.pending = r.pending
+	state.bits = state.bits[:0]
+	if r.loaded {
+		state.bits = append(state.bits, r.tickR.State())
+		for _, br := range r.fieldR {
+			state.bits = append(state.bits, br.State())
+		}
+	}
+	state.dec = state.dec[:0]
+	if r.started() {
+		state.dec = r.tickC.AppendState(state.dec)
+		for _, d := range r.fieldC {
+			state.dec = compress.AppendState(state.dec, d)
+		}
+	}
+}
+
+// Reset restores a state saved by SaveState, the reader is left unchanged
+// if the state can't be restored
+func (r *columnReader) Reset(state *columnReaderState) error {
+	if n := len(state.bits); n > 0 && n != len(r.fieldR)+1 {
+		return fmt.Errorf("error restoring reader state: got %d readers, was expecting %d", n, len(r.fieldR)+1)
+	}
+	if n := len(state.dec); n > 0 && n != r.stateSize() {
+		return fmt.Errorf("error restoring reader state: got state of %d bytes, was expecting %d", n, r.stateSize())
+	}
+	blockLoaded := len(state.bits) > 0
+	// The block is reopened if it was not loaded when the state was taken,
+	// else its decompressors are reused
+	reopen := state.blockIdx != r.blockIdx || !r.loaded || !blockLoaded
+	reuse := !reopen && r.started()
+	var tickC *compress.TickDecompress
+	var fieldC []compress.Decompress
+	if len(state.dec) > 0 && !reuse {
+		var err error
+		tickC, fieldC, err = r.decompressFromState(state.dec)
+		if err != nil {
+			return fmt.Errorf("error restoring reader state: %w", err)
+		}
+	}
+	if reopen {
+		prev := *r
+		r.openBlock(state.blockIdx)
+		if blockLoaded {
+			// The columns were decompressed when the state was taken
+			if err := r.loadBlock(); err != nil {
+				*r = prev
+				return fmt.Errorf("error restoring reader state: %w", err)
+			}
+		}
+	}
+	r.itemIdx = state.itemIdx
+	r.tick = state.tick
+	r.nextTick = state.nextTick
+	r.pending = state.pending
+	if blockLoaded {
+		r.tickR.Reset(state.bits[0])
+		for i, br := range r.fieldR {
+			br.Reset(state.bits[i+1])
+		}
+	}
+	switch {
+	case len(state.dec) == 0:
+		r.tickC = nil
+		for i := range r.fieldC {
+			r.fieldC[i] = nil
+		}
+	case reuse:
+		if err := r.restoreState(state.dec); err != nil {
+			return fmt.Errorf("error restoring reader state: %w", err)
+		}
+	default:
+		r.tickC = tickC
+		copy(r.fieldC, fieldC)
+	}
+	return nil
+}
+
+// started returns true if the decompressors of the block were created by
+// its first item
+func (r *columnReader) started() bool {
+	if r.tickC == nil {
+		return false
+	}
+	for _, d := range r.fieldC {
+		if d == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// stateSize returns the size of the state of the decompressors
+func (r *columnReader) stateSize() int {
+	size := compress.TickStateSize
+	for _, f := range r.fields {
+		size += compress.StateSize(r.info.Fields[f].CompressionVersion, r.info.fieldSize(f))
+	}
+	return size
+}
+
+// restoreState sets the state of the decompressors, it can only fail if the
+// state has not the size of their state
+func (r *columnReader) restoreState(state []byte) error {
+	if err := r.tickC.RestoreState(state[:compress.TickStateSize]); err != nil {
+		return err
+	}
+	offset := compress.TickStateSize
+	for i, f := range r.fields {
+		field := r.info.Fields[f]
+		n := compress.StateSize(field.CompressionVersion, r.info.fieldSize(f))
+		if err := compress.RestoreState(r.fieldC[i], state[offset:offset+n]); err != nil {
+			return fmt.Errorf("error loading field %s: %w", field.Name, err)
+		}
+		offset += n
+	}
+	return nil
+}
+
+// decompressFromState returns the decompressors of the columns with a
+// state saved by SaveState
+func (r *columnReader) decompressFromState(state []byte) (*compress.TickDecompress, []compress.Decompress, error) {
+	tickC, err := compress.TickDecompressFromState(state[:compress.TickStateSize])
+	if err != nil {
+		return nil, nil, err
+	}
+	fieldC := make([]compress.Decompress, len(r.fields))
+	offset := compress.TickStateSize
+	for i, f := range r.fields {
+		field := r.info.Fields[f]
+		n := compress.StateSize(field.CompressionVersion, r.info.fieldSize(f))
+		fieldC[i], err = compress.DecompressFromState(state[offset:offset+n], r.info.fieldSize(f), field.CompressionVersion)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error loading field %s: %w", field.Name, err)
+		}
+		offset += n
+	}
+	return tickC, fieldC, nil
+}
+
+func (r *columnReader) openBlock(idx int) {
+	r.blockIdx = idx
+	r.itemIdx = 0
+	r.pending = false
+	r.loaded = false
+	r.tickC = nil
+}
+
+// loadBlock creates the bit readers of the current block, decompressing
+// the selected columns if needed.
+func (r *columnReader) loadBlock() error {
+	b, _, _ := r.blocks.get(r.blockIdx)
+	if b == nil {
+		return io.EOF
+	}
+	c, err := b.column(0)
+	if err != nil {
+		return err
+	}
+	// The columns are all decompressed before the reader is changed
+	for _, f := range r.fields {
+		if _, err := b.column(f + 1); err != nil {
+			return err
+		}
+	}
+	// The bit readers are reused between the blocks
+	if r.tickR == nil {
+		r.tickR = compress.NewBitReader(c)
+	} else {
+		r.tickR.ResetBuffer(c)
+	}
+	for i, f := range r.fields {
+		c, _ := b.column(f + 1)
+		if r.fieldR[i] == nil {
+			r.fieldR[i] = compress.NewBitReader(c)
+		} else {
+			r.fieldR[i].ResetBuffer(c)
+		}
+		r.fieldC[i] = nil
+	}
+	r.loaded = true
+	return nil
+}
+
+func (r *columnReader) readItem(offset uintptr) error {
+	for i, f := range r.fields {
+		field := r.info.Fields[f]
+		ptr := unsafe.Pointer(uintptr(unsafe.Pointer(&r.val[0])) + offset + uintptr(field.Offset))
+		if r.fieldC[i] == nil {
+			d, err := compress.GetDecompress(r.fieldR[i], ptr, r.info.fieldSize(f), field.CompressionVersion)
+			if err != nil {
+				return err
+			}
+			if d == nil {
+				return fmt.Errorf("unknown compression version %d", field.CompressionVersion)
+			}
+			r.fieldC[i] = d
+		} else {
+			if err := r.fieldC[i].Decompress(r.fieldR[i], ptr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *columnReader) readTick() (uint64, error) {
+	if r.tickC == nil {
+		tickC, tick, err := compress.NewTickDecompress(r.tickR)
+		if err != nil {
+			return 0, err
+		}
+		r.tickC = tickC
+		return tick, nil
+	}
+	return r.tickC.Decompress(r.tickR)
+}
+
+// Next returns the next tick group, checking the context between the
+// blocks skipped
+func (r *columnReader) Next(ctx context.Context) (uint64, TickDeltas, error) {
+	delta := TickDeltas{
+		Pointer: nil,
+		Len:     0,
+	}
+	var b *columnBlock
+	var count int
+	for {
+		var last bool
+		b, count, last = r.blocks.get(r.blockIdx)
+		if b == nil {
+			return r.tick, delta, io.EOF
+		}
+		// Only blocks that can't grow anymore are skipped
+		if r.itemIdx == 0 && !last && r.skip != nil && r.skip(b) {
+			if err := ctx.Err(); err != nil {
+				return r.tick, delta, err
+			}
+			r.openBlock(r.blockIdx + 1)
+			continue
+		}
+		if r.itemIdx < count {
+			break
+		}
+		if last {
+			return r.tick, delta, io.EOF
+		}
+		r.openBlock(r.blockIdx + 1)
+	}
+	if !r.loaded {
+		if err := r.loadBlock(); err != nil {
+			return r.tick, delta, err
+		}
+	}
+	// The writer may be appending to the columns of the tail
+	b.RLock()
+	defer b.RUnlock()
+
+	if r.pending {
+		r.tick = r.nextTick
+		r.pending = false
+	} else {
+		tick, err := r.readTick()
+		if err != nil {
+			return r.tick, delta, unexpectedEOF(err)
+		}
+		r.tick = tick
+	}
+
+	var offset uintptr = 0
+	for {
+		if int(offset+r.size) > len(r.val) {
+			val := make([]byte, 2*len(r.val))
+			copy(val, r.val)
+			r.val = val
+		}
+		if err := r.readItem(offset); err != nil {
+			return r.tick, delta, unexpectedEOF(err)
+		}
+		offset += r.size
+		r.itemIdx += 1
+		delta.Len += 1
+		if r.itemIdx == count {
+			break
+		}
+		tick, err := r.readTick()
+		if err != nil {
+			return r.tick, delta, unexpectedEOF(err)
+		}
+		if tick != r.tick {
+			r.nextTick = tick
+			r.pending = true
+			break
+		}
+	}
+	delta.Pointer = unsafe.Pointer(&r.val[0])
+
+	return r.tick, delta, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (tf *TickFile) writeBlocks(tick uint64, ptr unsafe.Pointer, count int) error {
+	size := tf.dataType.Size()
+	tail := tf.blocks.tail()
+	if tail == nil || (tail.itemCount >= int(tf.blockSection.BlockSize) && tick != tf.lastTick) {
+		offset := tf.header.ItemStart
+		if tail != nil {
+			// Seal the tail, its encoded size gives the offset of the next block
+			encoded, err := tail.encode(tf.order, tf.blockSection.Compression)
+			if err != nil {
+				return fmt.Errorf("error encoding block: %w", err)
+			}
+			tail.encoded = encoded
+			tail.size = int64(len(encoded))
+			offset = tail.offset + tail.size
+		}
+		tail = newColumnBlock(offset, tf.itemSection)
+		tf.blocks.Lock()
+		tf.blocks.blocks = append(tf.blocks.blocks, tail)
+		tf.blocks.Unlock()
+		tf.bwriter = nil
+	}
+
+	first := tail.itemCount == 0
+	tail.Lock()
+	for i := 0; i < count; i++ {
+		itemPtr := unsafe.Pointer(uintptr(ptr) + uintptr(i)*size)
+		tail.updateStats(tf.itemSection, itemPtr)
+		if tf.bwriter == nil {
+			tf.bwriter = newBlockWriter(tail, tf.itemSection, tick, itemPtr)
+		} else {
+			tf.bwriter.Write(tail, tick, itemPtr)
+		}
+	}
+	tail.Unlock()
+
+	tf.blocks.Lock()
+	if first {
+		tail.firstTick = tick
+	}
+	tail.lastTick = tick
+	tail.itemCount += count
+	tf.blocks.Unlock()
+
+	return nil
+}
+
+// flushBlocks writes the blocks not flushed yet and returns the number of
+// bytes written. The tail written by the previous flush is kept after the
+// new blocks until they are written, synced first if sync is set.
+func (tf *TickFile) flushBlocks(sync bool) (int, error) {
+	tf.blocks.RLock()
+	blocks := tf.blocks.blocks[tf.flushedBlocks:]
+	tf.blocks.RUnlock()
+	if len(blocks) == 0 {
+		return 0, nil
+	}
+
+	encoded := make([][]byte, len(blocks))
+	end := blocks[0].offset
+	for i, b := range blocks {
+		encoded[i] = b.encoded
+		if encoded[i] == nil {
+			var err error
+			tf.blocks.RLock()
+			encoded[i], err = b.encode(tf.order, tf.blockSection.Compression)
+			tf.blocks.RUnlock()
+			if err != nil {
+				return 0, fmt.Errorf("error encoding block: %w", err)
+			}
+		}
+		end = b.offset + int64(len(encoded[i]))
+	}
+
+	if tf.flushedEncoding != nil {
+		// Keep the previous version of the tail out of the way of the
+		// rewrite, it is restored if the rewrite is torn
+		fallback := tf.offset
+		if fallback < end {
+			fallback = end
+			// Grow the file up to the copy first, with zeros
+			if err := tf.file.Truncate(fallback); err != nil {
+				return 0, fmt.Errorf("error growing file: %w", err)
+			}
+		}
+		buf := make([]byte, len(tf.flushedEncoding)+4)
+		copy(buf, tf.flushedEncoding)
+		tf.order.PutUint32(buf[len(tf.flushedEncoding):], uint32(len(tf.flushedEncoding)))
+		if _, err := tf.file.Seek(fallback, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if _, err := tf.file.Write(buf); err != nil {
+			return 0, fmt.Errorf("error writing previous tail block to file: %w", err)
+		}
+		if sync {
+			if err := tf.file.Sync(); err != nil {
+				return 0, fmt.Errorf("error syncing file: %w", err)
+			}
+		}
+	}
+
+	written := 0
+	for i, b := range blocks {
+		if _, err := tf.file.Seek(b.offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		n, err := tf.file.Write(encoded[i])
+		if err != nil {
+			return 0, fmt.Errorf("error writing block to file: %w", err)
+		}
+		b.encoded = nil
+		written += n
+	}
+	// Remove the previous version of the tail, a compressed tail can also
+	// get smaller than its previous version
+	if tf.flushedEncoding != nil || end < tf.offset {
+		if err := tf.file.Truncate(end); err != nil {
+			return 0, fmt.Errorf("error truncating file: %w", err)
+		}
+	}
+	tf.offset = end
+	// The tail block is rewritten until a new block is started
+	tf.flushedBlocks += len(blocks) - 1
+	tf.flushedEncoding = encoded[len(encoded)-1]
+	tf.flushedTail = tf.blocks.rawSize(tf.flushedBlocks)
+
+	return written, nil
+}
+
+// openBlocks loads the blocks of the item area of a columnar file.
+// A block cut short by a partial write is dropped, and replaced by the
+// previous version of the tail kept by the flush, if any. It returns
+// whether a block was dropped and the bytes of the restored tail.
+func (tf *TickFile) openBlocks(data []byte) (bool, []byte, error) {
+	columnCount := len(tf.itemSection.Fields) + 1
+	blocks, err := readColumnBlocks(data, tf.header.ItemStart, tf.order, columnCount, tf.blockSection.Compression)
+	corrupted := false
+	var restored []byte
+	if err != nil {
+		if err != ErrCorruptedBlock {
+			return false, nil, err
+		}
+		corrupted = true
+		var b *columnBlock
+		b, restored = readTailFallback(data, blocks, tf.header.ItemStart, tf.order, columnCount, tf.blockSection.Compression)
+		if b != nil {
+			blocks = append(blocks, b)
+		}
+	}
+	tf.blocks = &columnBlocks{blocks: blocks}
+	tf.offset = tf.header.ItemStart
+	tf.lastTick = 0
+	tf.itemCount = 0
+	for _, b := range blocks {
+		tf.itemCount += uint64(b.itemCount)
+	}
+	if len(blocks) > 0 {
+		tail := blocks[len(blocks)-1]
+		tf.offset = tail.offset + tail.size
+		tf.lastTick = tail.lastTick
+	}
+	return corrupted, restored, nil
+}
+
+func (tf *TickFile) openWriteBlocks(data []byte) error {
+	corrupted, restored, err := tf.openBlocks(data)
+	if err != nil {
+		return fmt.Errorf("error reading blocks: %w", err)
+	}
+	n := len(tf.blocks.blocks)
+	if n > 0 {
+		tail := tf.blocks.blocks[n-1]
+		if restored == nil {
+			restored = data[tail.offset-tf.header.ItemStart:][:tail.size]
+		} else {
+			// Put back the previous version of the torn tail, the copy at
+			// the end of the file is before the end of the tail
+			if _, err := tf.file.Seek(tail.offset, io.SeekStart); err != nil {
+				return err
+			}
+			if _, err := tf.file.Write(restored); err != nil {
+				return fmt.Errorf("error restoring tail block: %w", err)
+			}
+		}
+		tf.flushedEncoding = append([]byte(nil), restored...)
+	}
+	if corrupted {
+		// Drop the partially written block
+		if err := tf.file.Truncate(tf.offset); err != nil {
+			return fmt.Errorf("error truncating corrupted block: %w", err)
+		}
+		tf.recovered()
+	}
+	if n > 0 {
+		tail, w, err := blockWriterFromBlock(tf.blocks.blocks[n-1], tf.itemSection)
+		if err != nil {
+			return fmt.Errorf("error loading writer from block: %w", err)
+		}
+		tf.blocks.blocks[n-1] = tail
+		tf.bwriter = w
+		tf.flushedBlocks = n - 1
+	}
+	return nil
+}
+
+// fieldIndices returns the indices of the item section fields with the
+// given names. An array field can be selected by its name, which selects
+// all its elements.
+func (is *ItemSection) fieldIndices(names ...string) ([]int, error) {
+	var indices []int
+	selected := make(map[int]bool)
+	for _, name := range names {
+		found := false
+		for i, f := range is.Fields {
+			if f.Name == name || strings.HasPrefix(f.Name, name+".") {
+				if !selected[i] {
+					indices = append(indices, i)
+					selected[i] = true
+				}
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown field %s", name)
+		}
+	}
+	return indices, nil
+}
+
+func (is *ItemSection) fieldSize(i int) uint32 {
+	if i == len(is.Fields)-1 {
+		return is.Info.ItemSize - is.Fields[i].Offset
+	}
+	return is.Fields[i+1].Offset - is.Fields[i].Offset
+}
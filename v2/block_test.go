@@ -0,0 +1,628 @@
+package gotickfile
+
+import (
+	"errors"
+	"fmt"
+	"github.com/melaurent/gotickfile/v2/compress"
+	"github.com/melaurent/kafero"
+	"io"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+func writeColumnarFile(t *testing.T, name string, blockSize int, n int, configs ...TickFileConfig) ([]uint64, []Data) {
+	file, err := fs.Create(name)
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	configs = append([]TickFileConfig{
+		WithDataType(reflect.TypeOf(Data{})),
+		WithColumnarLayout(blockSize),
+		WithContentDescription("prices of acme at NYSE")}, configs...)
+	tf, err := Create(file, configs...)
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+
+	var ticks []uint64
+	var goldenDeltas []Data
+	var tick uint64 = 0
+	for i := 0; i < n; i++ {
+		if rand.Intn(3) != 0 {
+			tick += uint64(rand.Intn(100))
+		}
+		delta := Data{
+			Time:   tick,
+			Price:  uint32(rand.Intn(1000)),
+			Volume: uint64(rand.Intn(10)),
+			Prob:   uint32(rand.Int()),
+			Prib:   uint64(rand.Int()),
+		}
+		if err := tf.Write(tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+		ticks = append(ticks, tick)
+		goldenDeltas = append(goldenDeltas, delta)
+		if rand.Intn(50) == 0 {
+			if err := tf.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return ticks, goldenDeltas
+}
+
+func checkReader(t *testing.T, reader *CTickReader, ticks []uint64, goldenDeltas []Data, mask func(Data) Data) {
+	i := 0
+	tick, deltas, err := reader.Next()
+	for err == nil {
+		for j := 0; j < deltas.Len; j++ {
+			if i >= len(ticks) {
+				t.Fatalf("got more items than written")
+			}
+			if tick != ticks[i] {
+				t.Fatalf("got different tick: %d %d", tick, ticks[i])
+			}
+			ptr := unsafe.Pointer(uintptr(deltas.Pointer) + uintptr(j)*unsafe.Sizeof(Data{}))
+			if *(*Data)(ptr) != mask(goldenDeltas[i]) {
+				t.Fatalf("got different data: %v %v", *(*Data)(ptr), mask(goldenDeltas[i]))
+			}
+			i += 1
+		}
+		if i < len(ticks) && ticks[i] == tick {
+			t.Fatalf("group for tick %d was split", tick)
+		}
+		tick, deltas, err = reader.Next()
+	}
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+	if i != len(ticks) {
+		t.Fatalf("got %d items, was expecting %d", i, len(ticks))
+	}
+}
+
+func TestColumnarLayout(t *testing.T) {
+	ticks, goldenDeltas := writeColumnarFile(t, "columnar.tick", 64, 1000)
+
+	file, err := fs.Open("columnar.tick")
+	if err != nil {
+		t.Fatalf("error opening file: %v", err)
+	}
+	tf, err := OpenRead(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	if tf.LastTick() != ticks[len(ticks)-1] {
+		t.Fatalf("got different last tick: %d %d", tf.LastTick(), ticks[len(ticks)-1])
+	}
+	if tf.blocks.len() < 1000/64 {
+		t.Fatalf("was expecting at least %d blocks, got %d", 1000/64, tf.blocks.len())
+	}
+	reader, err := tf.GetTickReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReader(t, reader, ticks, goldenDeltas, func(d Data) Data { return d })
+
+	reader, err = tf.GetFieldReader("Price", "Volume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReader(t, reader, ticks, goldenDeltas, func(d Data) Data {
+		return Data{Price: d.Price, Volume: d.Volume}
+	})
+
+	if _, err := tf.GetFieldReader("Unknown"); err == nil {
+		t.Fatalf("was expecting an error for an unknown field")
+	}
+
+	if err := fs.Remove("columnar.tick"); err != nil {
+		t.Fatalf("error deleting tickfile: %v", err)
+	}
+}
+
+func TestColumnarAppend(t *testing.T) {
+	ticks, goldenDeltas := writeColumnarFile(t, "columnar.tick", 50, 120)
+
+	for k := 0; k < 3; k++ {
+		file, err := fs.OpenFile("columnar.tick", 2, 0644)
+		if err != nil {
+			t.Fatalf("error opening file: %v", err)
+		}
+		tf, err := OpenWrite(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening tickfile in write mode: %v", err)
+		}
+		if tf.LastTick() != ticks[len(ticks)-1] {
+			t.Fatalf("got different last tick: %d %d", tf.LastTick(), ticks[len(ticks)-1])
+		}
+		// Continue the last group, then add new ones
+		tick := ticks[len(ticks)-1]
+		for i := 0; i < 40; i++ {
+			delta := Data{Time: tick, Price: uint32(i), Volume: uint64(k), Prib: uint64(i * k)}
+			if err := tf.Write(tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+				t.Fatalf("error writing: %v", err)
+			}
+			ticks = append(ticks, tick)
+			goldenDeltas = append(goldenDeltas, delta)
+			tick += uint64(rand.Intn(3))
+		}
+		if err := tf.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file, err := fs.Open("columnar.tick")
+	if err != nil {
+		t.Fatalf("error opening file: %v", err)
+	}
+	tf, err := OpenRead(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	reader, err := tf.GetTickReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReader(t, reader, ticks, goldenDeltas, func(d Data) Data { return d })
+}
+
+func TestColumnarReadWriteMode(t *testing.T) {
+	file, err := fs.Create("columnar.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	tf, err := Create(
+		file,
+		WithDataType(reflect.TypeOf(Data{})),
+		WithColumnarLayout(4))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	reader, err := tf.GetFieldReader("Prib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		delta := Data{Prib: uint64(i * 3)}
+		if err := tf.Write(uint64(i), TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+		tick, deltas, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tick != uint64(i) || *(*Data)(deltas.Pointer) != delta {
+			t.Fatalf("got a different read than expected")
+		}
+		if _, _, err := reader.Next(); err != io.EOF {
+			t.Fatalf("was expecting EOF")
+		}
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestColumnarConcurrent(t *testing.T) {
+	file, err := fs.Create("columnar.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	tf, err := Create(
+		file,
+		WithDataType(reflect.TypeOf(Data{})),
+		WithColumnarLayout(64))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+
+	errChan := make(chan error, 100)
+
+	var wg sync.WaitGroup
+	wg.Add(4)
+	N := 20000
+	fn := func() {
+		defer wg.Done()
+		reader, err := tf.GetTickReader()
+		if err != nil {
+			errChan <- err
+			return
+		}
+		var expectedTick uint64 = 0
+		for expectedTick < uint64(N) {
+			tick, deltas, err := reader.Next()
+			if err != nil {
+				if err == io.EOF {
+					continue
+				} else {
+					errChan <- fmt.Errorf("unexpected ending: %v", err)
+					return
+				}
+			}
+			if tick != expectedTick || (*Data)(deltas.Pointer).Prib != tick*3 {
+				errChan <- fmt.Errorf("got different tick %d %d", tick, expectedTick)
+				return
+			}
+			expectedTick += 1
+		}
+	}
+	go fn()
+	go fn()
+	go fn()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < N; i++ {
+			delta := Data{
+				Time:  uint64(i),
+				Price: uint32(rand.Int()),
+				Prib:  uint64(i * 3),
+			}
+			if err := tf.Write(uint64(i), TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+				errChan <- fmt.Errorf("error writing: %v", err)
+				return
+			}
+			if i%16 == 0 {
+				if err := tf.Flush(); err != nil {
+					errChan <- err
+					return
+				}
+			}
+		}
+	}()
+
+	wg.Wait()
+
+	select {
+	case err := <-errChan:
+		t.Fatal(err)
+	default:
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestColumnarCorrupted(t *testing.T) {
+	ticks, goldenDeltas := writeColumnarFile(t, "columnar.tick", 64, 500)
+
+	file, err := fs.OpenFile("columnar.tick", 2, 0644)
+	if err != nil {
+		t.Fatalf("error opening file: %v", err)
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cut the last block as if the recorder crashed while writing it
+	if err := file.Truncate(fi.Size() - 3); err != nil {
+		t.Fatal(err)
+	}
+	tf, err := OpenRead(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	n := 0
+	for _, b := range tf.blocks.blocks {
+		n += b.itemCount
+	}
+	if n >= len(ticks) || n == 0 {
+		t.Fatalf("was expecting the last block to be dropped, got %d items", n)
+	}
+	reader, err := tf.GetTickReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReader(t, reader, ticks[:n], goldenDeltas[:n], func(d Data) Data { return d })
+}
+
+func TestColumnarCorruptedBlock(t *testing.T) {
+	ticks, _ := writeColumnarFile(t, "columnar.tick", 64, 500)
+
+	file, err := fs.OpenFile("columnar.tick", 2, 0644)
+	if err != nil {
+		t.Fatalf("error opening file: %v", err)
+	}
+	tf, err := OpenRead(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	// Flip a byte of the columns of the second block, only the tail is
+	// checked when opening
+	b := tf.blocks.blocks[1]
+	buf := make([]byte, 1)
+	if _, err := file.ReadAt(buf, b.offset+b.size-5); err != nil {
+		t.Fatal(err)
+	}
+	buf[0] ^= 0xff
+	if _, err := file.WriteAt(buf, b.offset+b.size-5); err != nil {
+		t.Fatal(err)
+	}
+	observer := NewCounterObserver()
+	tf, err = OpenRead(file, reflect.TypeOf(Data{}), WithObserver(observer))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	if observer.Counters()["corruption_recovery_total"] != 0 || tf.itemCount != uint64(len(ticks)) {
+		t.Fatalf("was expecting all the blocks to be loaded")
+	}
+	reader, err := tf.GetTickReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for {
+		_, deltas, err := reader.Next()
+		if err != nil {
+			if !errors.Is(err, ErrCorruptedBlock) {
+				t.Fatalf("was expecting a corrupted block error, got %v", err)
+			}
+			break
+		}
+		n += deltas.Len
+	}
+	if n != tf.blocks.blocks[0].itemCount {
+		t.Fatalf("was expecting the items of the first block, got %d", n)
+	}
+}
+
+func TestColumnarTornTail(t *testing.T) {
+	for _, torn := range []string{"flipped", "leftover"} {
+		ticks, goldenDeltas := writeColumnarFile(t, "columnar.tick", 64, 500)
+		file, err := fs.OpenFile("columnar.tick", 2, 0644)
+		if err != nil {
+			t.Fatalf("error opening file: %v", err)
+		}
+		tf, err := OpenRead(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening tickfile: %v", err)
+		}
+		tail := tf.blocks.blocks[len(tf.blocks.blocks)-1]
+		n := len(ticks) - tail.itemCount
+		switch torn {
+		case "flipped":
+			// A rewrite of the tail torn in the middle of the block
+			b := make([]byte, 1)
+			if _, err := file.ReadAt(b, tail.offset+tail.size/2); err != nil {
+				t.Fatal(err)
+			}
+			b[0] ^= 0xff
+			if _, err := file.WriteAt(b, tail.offset+tail.size/2); err != nil {
+				t.Fatal(err)
+			}
+		case "leftover":
+			// A shorter rewrite of the tail, not truncated
+			b := make([]byte, tail.size/2)
+			if _, err := file.ReadAt(b, tail.offset+tail.size/4); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := file.WriteAt(b, tail.offset+tail.size); err != nil {
+				t.Fatal(err)
+			}
+			n = len(ticks)
+		}
+
+		observer := NewCounterObserver()
+		tf, err = OpenRead(file, reflect.TypeOf(Data{}), WithObserver(observer))
+		if err != nil {
+			t.Fatalf("%s: error opening tickfile: %v", torn, err)
+		}
+		if observer.Counters()["corruption_recovery_total"] != 1 {
+			t.Fatalf("%s: was expecting a corruption recovery", torn)
+		}
+		reader, err := tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReader(t, reader, ticks[:n], goldenDeltas[:n], func(d Data) Data { return d })
+
+		// The torn block is dropped before appending
+		tf, err = OpenWrite(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("%s: error opening tickfile for writing: %v", torn, err)
+		}
+		delta := Data{Time: ticks[n-1] + 1}
+		if err := tf.Write(delta.Time, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+		if err := tf.Close(); err != nil {
+			t.Fatal(err)
+		}
+		tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("%s: error opening tickfile: %v", torn, err)
+		}
+		reader, err = tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReader(t, reader, append(ticks[:n:n], delta.Time), append(goldenDeltas[:n:n], delta), func(d Data) Data { return d })
+	}
+}
+
+// tornFile simulates a crash after limit bytes are written, nothing is
+// written after
+type tornFile struct {
+	kafero.File
+	limit int
+	torn  bool
+}
+
+func (f *tornFile) Write(b []byte) (int, error) {
+	if f.torn {
+		return 0, io.ErrShortWrite
+	}
+	if f.limit >= 0 && len(b) > f.limit {
+		n, _ := f.File.Write(b[:f.limit])
+		f.torn = true
+		return n, io.ErrShortWrite
+	}
+	if f.limit >= 0 {
+		f.limit -= len(b)
+	}
+	return f.File.Write(b)
+}
+
+func (f *tornFile) Truncate(size int64) error {
+	if f.torn {
+		return io.ErrShortWrite
+	}
+	return f.File.Truncate(size)
+}
+
+func TestColumnarTornRewrite(t *testing.T) {
+	for limit := 0; ; limit += 61 {
+		file, err := fs.Create("columnar.tick")
+		if err != nil {
+			t.Fatalf("error creating file")
+		}
+		tfile := &tornFile{File: file, limit: -1}
+		tf, err := Create(
+			tfile,
+			WithDataType(reflect.TypeOf(Data{})),
+			WithColumnarLayout(64))
+		if err != nil {
+			t.Fatalf("error creating tickfile: %v", err)
+		}
+		var ticks []uint64
+		var goldenDeltas []Data
+		write := func(n int) {
+			for i := 0; i < n; i++ {
+				tick := uint64(len(ticks))
+				delta := Data{Time: tick, Price: uint32(rand.Intn(1000)), Prib: uint64(rand.Int())}
+				if err := tf.Write(tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+					t.Fatalf("error writing: %v", err)
+				}
+				ticks = append(ticks, tick)
+				goldenDeltas = append(goldenDeltas, delta)
+			}
+		}
+		write(40)
+		if err := tf.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		// The flush rewrites the tail and starts a new block
+		write(60)
+		tfile.limit = limit
+		done := tf.Flush() == nil
+
+		tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening tickfile: %v", err)
+		}
+		n := int(tf.itemCount)
+		if n < 40 || (done && n != len(ticks)) {
+			t.Fatalf("torn after %d bytes: was expecting the flushed items, got %d items", limit, n)
+		}
+		reader, err := tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReader(t, reader, ticks[:n], goldenDeltas[:n], func(d Data) Data { return d })
+
+		// The tail is restored before appending
+		tf, err = OpenWrite(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening tickfile for writing: %v", err)
+		}
+		ticks, goldenDeltas = ticks[:n], goldenDeltas[:n]
+		write(1)
+		if err := tf.Close(); err != nil {
+			t.Fatal(err)
+		}
+		tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening tickfile: %v", err)
+		}
+		reader, err = tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReader(t, reader, ticks, goldenDeltas, func(d Data) Data { return d })
+		if done {
+			break
+		}
+	}
+}
+
+func TestColumnarBlockCompression(t *testing.T) {
+	for _, c := range []uint8{compress.ZstdBlockCompressType, compress.LZ4BlockCompressType} {
+		writeColumnarFile(t, "columnar.tick", 256, 5000)
+		fi, err := fs.Stat("columnar.tick")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rawSize := fi.Size()
+
+		ticks, goldenDeltas := writeColumnarFile(t, "compressed.tick", 256, 5000, WithBlockCompression(c))
+		fi, err = fs.Stat("compressed.tick")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() >= rawSize {
+			t.Fatalf("was expecting compressed file to be smaller: %d %d", fi.Size(), rawSize)
+		}
+
+		// Append to the compressed file
+		file, err := fs.OpenFile("compressed.tick", 2, 0644)
+		if err != nil {
+			t.Fatalf("error opening file: %v", err)
+		}
+		tf, err := OpenWrite(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening tickfile in write mode: %v", err)
+		}
+		tick := ticks[len(ticks)-1]
+		for i := 0; i < 1000; i++ {
+			delta := Data{Time: tick, Price: uint32(i % 7), Volume: 1}
+			if err := tf.Write(tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+				t.Fatalf("error writing: %v", err)
+			}
+			ticks = append(ticks, tick)
+			goldenDeltas = append(goldenDeltas, delta)
+			tick += uint64(rand.Intn(3))
+			if i%100 == 0 {
+				if err := tf.Flush(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if err := tf.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		file, err = fs.Open("compressed.tick")
+		if err != nil {
+			t.Fatalf("error opening file: %v", err)
+		}
+		tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening tickfile: %v", err)
+		}
+		reader, err := tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReader(t, reader, ticks, goldenDeltas, func(d Data) Data { return d })
+
+		reader, err = tf.GetFieldReader("Volume")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReader(t, reader, ticks, goldenDeltas, func(d Data) Data {
+			return Data{Volume: d.Volume}
+		})
+
+		if err := fs.Remove("compressed.tick"); err != nil {
+			t.Fatalf("error deleting tickfile: %v", err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package gotickfile
+
+import (
+	"github.com/melaurent/gotickfile/v2/compress"
+	"reflect"
+	"unsafe"
+)
+
+// byteSwap is a value of size bytes in an item, stored without
+// compression, that must be swapped when the file was written with the
+// opposite byte order
+type byteSwap struct {
+	offset uintptr
+	size   uintptr
+}
+
+// byteSwaps returns the swaps to apply to the items of the file, nil if
+// the file has the native byte order.
+func (tf *TickFile) byteSwaps() []byteSwap {
+	if tf.order == nativeEndian || tf.itemSection == nil {
+		return nil
+	}
+	var swaps []byteSwap
+	for _, f := range tf.itemSection.Fields {
+		if f.CompressionVersion != compress.NoneCompressType {
+			// Compressed values are decoded in the native byte order
+			continue
+		}
+		typ := tf.dataType
+		if typ.Kind() == reflect.Struct {
+			sf, ok := typ.FieldByName(f.Name)
+			if !ok {
+				continue
+			}
+			typ = sf.Type
+		}
+		swaps = appendByteSwaps(swaps, uintptr(f.Offset), typ)
+	}
+	return swaps
+}
+
+func appendByteSwaps(swaps []byteSwap, offset uintptr, typ reflect.Type) []byteSwap {
+	switch typ.Kind() {
+	case reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		swaps = append(swaps, byteSwap{offset: offset, size: typ.Size()})
+	case reflect.Array:
+		elem := typ.Elem()
+		for i := 0; i < typ.Len(); i++ {
+			swaps = appendByteSwaps(swaps, offset+uintptr(i)*elem.Size(), elem)
+		}
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			swaps = appendByteSwaps(swaps, offset+f.Offset, f.Type)
+		}
+	}
+	return swaps
+}
+
+// swapItems applies the swaps to n items at ptr
+func swapItems(ptr unsafe.Pointer, n int, itemSize uintptr, swaps []byteSwap) {
+	for i := 0; i < n; i++ {
+		for _, s := range swaps {
+			v := unsafeBytes(unsafe.Pointer(uintptr(ptr)+uintptr(i)*itemSize+s.offset), int(s.size))
+			for k, l := 0, len(v)-1; k < l; k, l = k+1, l-1 {
+				v[k], v[l] = v[l], v[k]
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package gotickfile
+
+import (
+	"bytes"
+	"io"
+	"math/bits"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+type SwapData struct {
+	Time   uint64
+	Price  uint32    `compress:"none"`
+	Sizes  [2]uint16 `compress:"none"`
+	Flag   uint8     `compress:"none"`
+	Volume uint64
+}
+
+func swapData(d SwapData) SwapData {
+	d.Price = bits.ReverseBytes32(d.Price)
+	d.Sizes[0] = bits.ReverseBytes16(d.Sizes[0])
+	d.Sizes[1] = bits.ReverseBytes16(d.Sizes[1])
+	return d
+}
+
+// withSwappedEndian writes the file in the opposite byte order, the raw
+// fields of the written items must be swapped by the caller
+func withSwappedEndian() TickFileConfig {
+	return func(tf *TickFile) {
+		tf.order = swappedEndian
+	}
+}
+
+func checkSwapReader(t *testing.T, next func() (uint64, TickDeltas, error), golden []SwapData) {
+	i := 0
+	for {
+		tick, deltas, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < deltas.Len; j++ {
+			d := *(*SwapData)(unsafe.Pointer(uintptr(deltas.Pointer) + uintptr(j)*unsafe.Sizeof(SwapData{})))
+			if tick != uint64(i) || d != golden[i] {
+				t.Fatalf("got different item at %d: %d %v %v", i, tick, d, golden[i])
+			}
+			i += 1
+		}
+	}
+	if i != len(golden) {
+		t.Fatalf("got %d items, was expecting %d", i, len(golden))
+	}
+}
+
+func TestForeignByteOrder(t *testing.T) {
+	for _, configs := range [][]TickFileConfig{nil, {WithColumnarLayout(16)}} {
+		file, err := fs.Create("swapped.tick")
+		if err != nil {
+			t.Fatalf("error creating file")
+		}
+		configs = append([]TickFileConfig{
+			WithDataType(reflect.TypeOf(SwapData{})),
+			WithNameValues(map[string]interface{}{"Size": int32(12)}),
+			withSwappedEndian(),
+		}, configs...)
+		tf, err := Create(file, configs...)
+		if err != nil {
+			t.Fatalf("error creating tickfile: %v", err)
+		}
+		var golden []SwapData
+		for i := 0; i < 100; i++ {
+			d := SwapData{
+				Time:   uint64(i),
+				Price:  uint32(i * 1000003),
+				Sizes:  [2]uint16{uint16(i * 301), uint16(i + 0x100)},
+				Flag:   uint8(i),
+				Volume: uint64(i % 3),
+			}
+			golden = append(golden, d)
+			swapped := swapData(d)
+			if err := tf.Write(uint64(i), TickDeltas{Pointer: unsafe.Pointer(&swapped), Len: 1}); err != nil {
+				t.Fatalf("error writing: %v", err)
+			}
+		}
+		if err := tf.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		tf, err = OpenRead(file, reflect.TypeOf(SwapData{}))
+		if err != nil {
+			t.Fatalf("error opening tickfile: %v", err)
+		}
+		if tf.order != swappedEndian {
+			t.Fatalf("was expecting the swapped byte order")
+		}
+		if tf.LastTick() != 99 {
+			t.Fatalf("got different last tick: %d", tf.LastTick())
+		}
+		if v := tf.GetNameValues()["Size"]; v != int32(12) {
+			t.Fatalf("got different name value: %v", v)
+		}
+		reader, err := tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSwapReader(t, reader.Next, golden)
+
+		if _, err := OpenWrite(file, reflect.TypeOf(SwapData{})); err != ErrForeignByteOrder {
+			t.Fatalf("was expecting foreign byte order error, got %v", err)
+		}
+	}
+}
+
+func TestForeignByteOrderStream(t *testing.T) {
+	var buf bytes.Buffer
+	file, err := fs.Create("swapped.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	tf, err := Create(file, WithDataType(reflect.TypeOf(SwapData{})), withSwappedEndian())
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	var golden []SwapData
+	for i := 0; i < 100; i++ {
+		d := SwapData{Time: uint64(i), Price: uint32(i << 20), Sizes: [2]uint16{uint16(i << 8), 1}}
+		golden = append(golden, d)
+		swapped := swapData(d)
+		if err := tf.Write(uint64(i), TickDeltas{Pointer: unsafe.Pointer(&swapped), Len: 1}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(&buf, file); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewStreamReader(&buf, reflect.TypeOf(SwapData{}))
+	if err != nil {
+		t.Fatalf("error creating stream reader: %v", err)
+	}
+	checkSwapReader(t, reader.Next, golden)
+}
@@ -0,0 +1,251 @@
+package gotickfile
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/melaurent/gotickfile/v2/compress"
+	"io"
+	"reflect"
+	"unsafe"
+)
+
+// Number of bytes of data flushed between two checkpoints, opening a file
+// decodes at most this much data
+const checkpointInterval = 1 << 16
+
+// WithCheckpoint creates a stream file with a checkpoint section, holding
+// the state of the writer every checkpointInterval bytes flushed. Opening
+// the file reads and decodes only the data after the checkpoint, instead
+// of all the data. The checkpoint section is not known to the versions
+// of this package before it, which can't open such files.
+func WithCheckpoint() TickFileConfig {
+	return func(tf *TickFile) {
+		tf.checkpoint = true
+	}
+}
+
+// dataBits returns the size of the data area in bits
+func (tf *TickFile) dataBits() int64 {
+	return tf.dataBase*8 + tf.block.BitLen()
+}
+
+// readTail reads the data area of a stream file from a few bytes before
+// the checkpoint, the last two bytes being rewritten by the flushes. The
+// whole data area is read if the file has no usable checkpoint. The data
+// before is read by loadData.
+func (tf *TickFile) readTail(ctx context.Context) ([]byte, error) {
+	cs := tf.checkpointSection
+	start := tf.header.ItemStart
+	if tf.blockSection == nil && cs != nil && len(cs.State) == tf.itemSection.stateSize() {
+		if base := cs.DataBits/8 - 2; base > 0 {
+			size, err := tf.file.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, fmt.Errorf("error seeking to end of file: %w", err)
+			}
+			if start+base < size {
+				tf.dataBase = base
+				start += base
+			}
+		}
+	}
+	if _, err := tf.file.Seek(start, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("error seeking to data: %w", err)
+	}
+	return readAllContext(ctx, tf.file)
+}
+
+// loadData reads the data before the tail read by readTail, for the
+// readers of the whole data area.
+func (tf *TickFile) loadData() error {
+	tf.Lock()
+	defer tf.Unlock()
+	return tf.loadDataLocked()
+}
+
+// loadDataLocked is loadData for a caller holding the lock of the file
+func (tf *TickFile) loadDataLocked() error {
+	if tf.dataBase == 0 {
+		return nil
+	}
+	if _, err := tf.file.Seek(tf.header.ItemStart, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking to data: %w", err)
+	}
+	data := make([]byte, tf.dataBase)
+	if _, err := io.ReadFull(tf.file, data); err != nil {
+		return fmt.Errorf("error reading data: %w", err)
+	}
+	// The file position is the one of the next write
+	if _, err := tf.file.Seek(tf.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking to end of data: %w", err)
+	}
+	tf.block.Lock()
+	block := compress.NewBBuffer(append(data, tf.block.Bytes()...), tf.block.Count())
+	tf.block.Unlock()
+	tf.block = block
+	tf.lastWrite += int(tf.dataBase)
+	tf.dataBase = 0
+	return nil
+}
+
+// stateSize returns the size of the state of the writer of the section
+func (is *ItemSection) stateSize() int {
+	size := compress.TickStateSize
+	for i, f := range is.Fields {
+		size += compress.StateSize(f.CompressionVersion, is.fieldSize(i))
+	}
+	return size
+}
+
+// validCheckpoint returns true if the checkpoint can be used on a data area
+// of dataBits bits.
+func (tf *TickFile) validCheckpoint(dataBits int64) bool {
+	cs := tf.checkpointSection
+	return cs != nil && cs.DataBits > 0 && cs.DataBits <= dataBits &&
+		len(cs.State) == tf.itemSection.stateSize()
+}
+
+// decompressFromState returns the decompressors of items of the type with
+// the state saved by marshalState
+func decompressFromState(info *ItemSection, typ reflect.Type, state []byte) (*compress.TickDecompress, *StructDecompress, error) {
+	if len(state) != info.stateSize() {
+		return nil, nil, fmt.Errorf("got state of %d bytes, was expecting %d", len(state), info.stateSize())
+	}
+	tickDec, err := compress.TickDecompressFromState(state[:compress.TickStateSize])
+	if err != nil {
+		return nil, nil, err
+	}
+	size := typ.Size()
+	structDec := &StructDecompress{
+		readers: make([]FieldReader, len(info.Fields)),
+		val:     make([]byte, size),
+		size:    size,
+	}
+	structDec.uptr = unsafe.Pointer(&structDec.val[0])
+	offset := compress.TickStateSize
+	for i, f := range info.Fields {
+		fieldSize := info.fieldSize(i)
+		n := compress.StateSize(f.CompressionVersion, fieldSize)
+		d, err := compress.DecompressFromState(state[offset:offset+n], fieldSize, f.CompressionVersion)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error loading field %s: %w", f.Name, err)
+		}
+		structDec.readers[i] = FieldReader{
+			offset: uintptr(f.Offset),
+			d:      d,
+		}
+		offset += n
+	}
+	return tickDec, structDec, nil
+}
+
+// appendState appends the state of the decompressors to dst, it is the
+// state marshalState returns for their compressors
+func appendState(dst []byte, tickDec *compress.TickDecompress, structDec *StructDecompress) []byte {
+	dst = tickDec.AppendState(dst)
+	for _, r := range structDec.readers {
+		dst = compress.AppendState(dst, r.d)
+	}
+	return dst
+}
+
+// restoreState sets the state of the decompressors of items of the type to
+// a state saved by appendState or marshalState. The decompressors are left
+// unchanged if the state has not the size of the state of the items.
+func restoreState(info *ItemSection, tickDec *compress.TickDecompress, structDec *StructDecompress, state []byte) error {
+	if len(state) != info.stateSize() {
+		return fmt.Errorf("got state of %d bytes, was expecting %d", len(state), info.stateSize())
+	}
+	if err := tickDec.RestoreState(state[:compress.TickStateSize]); err != nil {
+		return err
+	}
+	offset := compress.TickStateSize
+	for i, f := range info.Fields {
+		n := compress.StateSize(f.CompressionVersion, info.fieldSize(i))
+		if err := compress.RestoreState(structDec.readers[i].d, state[offset:offset+n]); err != nil {
+			return fmt.Errorf("error loading field %s: %w", f.Name, err)
+		}
+		offset += n
+	}
+	return nil
+}
+
+// marshalState returns the state of the compressors
+func marshalState(tickC *compress.TickCompress, structC *StructCompress) []byte {
+	state := tickC.MarshalState()
+	for _, w := range structC.writers {
+		state = append(state, w.c.MarshalState()...)
+	}
+	return state
+}
+
+// ctickWriterFromCheckpoint is like ctickWriterFromBlock, but only decodes
+// the data written after the checkpoint.
+func (tf *TickFile) ctickWriterFromCheckpoint() (*CTickWriter, uint64, uint64, error) {
+	cs := tf.checkpointSection
+	tickDec, structDec, err := decompressFromState(tf.itemSection, tf.dataType, cs.State)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	lastTick := cs.LastTick
+	itemCount := cs.ItemCount
+	br := compress.NewBitReaderAt(tf.block, cs.DataBits-tf.dataBase*8)
+	for !br.End() {
+		tick, err := tickDec.Decompress(br)
+		if err != nil {
+			if err == io.EOF {
+				break
+			} else {
+				return nil, 0, 0, err
+			}
+		}
+		if _, err := structDec.Decompress(br); err != nil {
+			return nil, 0, 0, err
+		}
+		structDec.Clear()
+		lastTick = tick
+		itemCount += 1
+	}
+
+	return &CTickWriter{
+		tickC:   tickDec.ToCompress(),
+		structC: structDec.ToCompress(),
+	}, lastTick, itemCount, nil
+}
+
+// writeCheckpoint rewrites the checkpoint section with the state of the
+// writer, if checkpointInterval bytes were flushed since the last one or if
+// force is set. The data must be flushed.
+func (tf *TickFile) writeCheckpoint(force bool) error {
+	cs := tf.checkpointSection
+	if tf.writer == nil {
+		return nil
+	}
+	dataBits := tf.dataBits()
+	if dataBits == cs.DataBits || (!force && dataBits-cs.DataBits < checkpointInterval*8) {
+		return nil
+	}
+	state := marshalState(tf.writer.tickC, tf.writer.structC)
+	if len(state) != len(cs.State) {
+		return fmt.Errorf("got state of %d bytes, was expecting %d", len(state), len(cs.State))
+	}
+	cs.DataBits = dataBits
+	cs.LastTick = tf.lastTick
+	cs.ItemCount = tf.itemCount
+	cs.State = state
+
+	// Write the section in one call, some files move their offset to the
+	// end on every write
+	var buf bytes.Buffer
+	if err := cs.Write(&buf, tf.order); err != nil {
+		return err
+	}
+	if _, err := tf.file.WriteAt(buf.Bytes(), tf.checkpointOffset); err != nil {
+		return err
+	}
+	if _, err := tf.file.Seek(tf.offset, io.SeekStart); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package gotickfile
+
+import (
+	"bytes"
+	"github.com/melaurent/kafero"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func writeCheckpointTicks(t *testing.T, tf *TickFile, from, to int) {
+	for i := from; i < to; i++ {
+		delta := Data{Time: uint64(i), Price: uint32(rand.Int()), Volume: uint64(i % 7)}
+		if err := tf.Write(uint64(i/2), TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+		if i%100 == 0 {
+			if err := tf.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func checkCheckpointTicks(t *testing.T, tf *TickFile, n int) {
+	if tf.LastTick() != uint64((n-1)/2) {
+		t.Fatalf("got different last tick: %d", tf.LastTick())
+	}
+	if tf.itemCount != uint64(n) {
+		t.Fatalf("got different item count: %d", tf.itemCount)
+	}
+	reader, err := tf.GetTickReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for {
+		tick, deltas, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < deltas.Len; i++ {
+			d := *(*Data)(unsafe.Pointer(uintptr(deltas.Pointer) + uintptr(i)*unsafe.Sizeof(Data{})))
+			if d.Time != uint64(count) || tick != uint64(count/2) {
+				t.Fatalf("got different item at %d: %d %d", count, tick, d.Time)
+			}
+			count += 1
+		}
+	}
+	if count != n {
+		t.Fatalf("got %d items, was expecting %d", count, n)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	file, err := fs.Create("checkpoint.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	tf, err := Create(file, WithDataType(reflect.TypeOf(Data{})), WithCheckpoint())
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	writeCheckpointTicks(t, tf, 0, 20000)
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if tf.checkpointSection.DataBits != tf.dataBits() {
+		t.Fatalf("checkpoint not written on close")
+	}
+
+	tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	checkCheckpointTicks(t, tf, 20000)
+
+	// Resume writing from the checkpoint, without closing the file the
+	// checkpoint stays behind the data
+	tf, err = OpenWrite(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	writeCheckpointTicks(t, tf, 20000, 20500)
+	if err := tf.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if tf.checkpointSection.DataBits >= tf.dataBits() {
+		t.Fatalf("was expecting a checkpoint behind the data")
+	}
+	tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	checkCheckpointTicks(t, tf, 20500)
+
+	tf, err = OpenWrite(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	writeCheckpointTicks(t, tf, 20500, 21000)
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	checkCheckpointTicks(t, tf, 21000)
+}
+
+func TestCheckpointFallback(t *testing.T) {
+	file, err := fs.Create("checkpoint.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	tf, err := Create(file, WithDataType(reflect.TypeOf(Data{})), WithCheckpoint())
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	writeCheckpointTicks(t, tf, 0, 1000)
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A checkpoint past the end of the data is ignored
+	cs := tf.checkpointSection
+	cs.DataBits = tf.block.BitLen() + 8
+	var buf bytes.Buffer
+	if err := cs.Write(&buf, nativeEndian); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt(buf.Bytes(), tf.checkpointOffset); err != nil {
+		t.Fatal(err)
+	}
+	tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	checkCheckpointTicks(t, tf, 1000)
+	tf, err = OpenWrite(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	writeCheckpointTicks(t, tf, 1000, 2000)
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	checkCheckpointTicks(t, tf, 2000)
+}
+
+// readCountFile counts the bytes read from the file
+type readCountFile struct {
+	kafero.File
+	read int
+}
+
+func (f *readCountFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.read += n
+	return n, err
+}
+
+func TestCheckpointTail(t *testing.T) {
+	mfile, err := fs.Create("checkpoint.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	tf, err := Create(mfile, WithDataType(reflect.TypeOf(Data{})), WithCheckpoint())
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	writeCheckpointTicks(t, tf, 0, 20000)
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := mfile.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the header and the data after the checkpoint are read
+	file := &readCountFile{File: mfile}
+	tf, err = OpenWrite(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	if file.read > int(tf.header.ItemStart)+16 || fi.Size() < checkpointInterval {
+		t.Fatalf("read %d bytes of a file of %d bytes", file.read, fi.Size())
+	}
+	writeCheckpointTicks(t, tf, 20000, 20500)
+	if err := tf.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// The data before the tail is read by the readers
+	checkCheckpointTicks(t, tf, 20500)
+	writeCheckpointTicks(t, tf, 20500, 21000)
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file.read = 0
+	tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	if file.read > int(tf.header.ItemStart)+16 {
+		t.Fatalf("read %d bytes of a file of %d bytes", file.read, fi.Size())
+	}
+	if _, val, err := tf.ReadItem(20999); err != nil || val.(*Data).Time != 20999 {
+		t.Fatalf("got different last item: %v %v", val, err)
+	}
+	checkCheckpointTicks(t, tf, 21000)
+}
+
+func TestWithoutCheckpoint(t *testing.T) {
+	file, err := fs.Create("checkpoint.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	// The checkpoint section is opt-in
+	tf, err := Create(file, WithDataType(reflect.TypeOf(Data{})))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	writeCheckpointTicks(t, tf, 0, 1000)
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	if tf.checkpointSection != nil {
+		t.Fatalf("was expecting no checkpoint section")
+	}
+	checkCheckpointTicks(t, tf, 1000)
+}
@@ -0,0 +1,194 @@
+package gotickfile
+
+import (
+	"fmt"
+	"github.com/melaurent/kafero"
+	"io"
+	"reflect"
+	"unsafe"
+)
+
+type MergePolicy uint8
+
+const (
+	// Keep the value of the first source having it
+	MERGE_FIRST MergePolicy = iota
+	// Keep the value of the last source having it
+	MERGE_LAST
+	// Fail if two sources have different values
+	MERGE_STRICT
+)
+
+type CompactConfig func(c *compactor)
+
+// WithMergePolicy sets how the tags, name values and content description
+// of the sources are merged. The default is MERGE_FIRST.
+func WithMergePolicy(policy MergePolicy) CompactConfig {
+	return func(c *compactor) {
+		c.policy = policy
+	}
+}
+
+// WithOutputConfigs adds configs used to create the compacted file, applied
+// after the merged sections and the layout of the first source.
+func WithOutputConfigs(configs ...TickFileConfig) CompactConfig {
+	return func(c *compactor) {
+		c.configs = append(c.configs, configs...)
+	}
+}
+
+type compactor struct {
+	policy  MergePolicy
+	configs []TickFileConfig
+}
+
+func (c *compactor) merge(kind, name string, has bool, old, val interface{}) (interface{}, error) {
+	if !has {
+		return val, nil
+	}
+	switch c.policy {
+	case MERGE_LAST:
+		return val, nil
+	case MERGE_STRICT:
+		if !reflect.DeepEqual(old, val) {
+			return nil, fmt.Errorf("conflicting values for %s %s: %v and %v", kind, name, old, val)
+		}
+	}
+	return old, nil
+}
+
+// Compact merges the tick files of srcs into dst, in tick order. Items of
+// the same tick that are identical in several sources, as left by
+// overlapping recordings, are only written once: an item is written as
+// many times as the source having it the most.
+func Compact(dst kafero.File, srcs []kafero.File, typ reflect.Type, configs ...CompactConfig) (err error) {
+	c := &compactor{policy: MERGE_FIRST}
+	for _, config := range configs {
+		config(c)
+	}
+
+	var tags map[string]string
+	var nameValues map[string]interface{}
+	var description *string
+	var readers []*CTickReader
+	var first *TickFile
+	for i, src := range srcs {
+		tf, err := OpenRead(src, typ)
+		if err != nil {
+			return fmt.Errorf("error opening source %d: %w", i, err)
+		}
+		defer tf.Close()
+		if first == nil {
+			first = tf
+		}
+		for k, v := range tf.GetTags() {
+			if tags == nil {
+				tags = make(map[string]string)
+			}
+			old, has := tags[k]
+			val, err := c.merge("tag", k, has, old, v)
+			if err != nil {
+				return err
+			}
+			tags[k] = val.(string)
+		}
+		for k, v := range tf.GetNameValues() {
+			if nameValues == nil {
+				nameValues = make(map[string]interface{})
+			}
+			old, has := nameValues[k]
+			val, err := c.merge("name value", k, has, old, v)
+			if err != nil {
+				return err
+			}
+			nameValues[k] = val
+		}
+		if d := tf.GetContentDescription(); d != nil {
+			var old string
+			if description != nil {
+				old = *description
+			}
+			val, err := c.merge("content description", "", description != nil, old, *d)
+			if err != nil {
+				return err
+			}
+			s := val.(string)
+			description = &s
+		}
+		reader, err := tf.GetTickReader()
+		if err != nil {
+			return fmt.Errorf("error getting reader of source %d: %w", i, err)
+		}
+		readers = append(readers, reader)
+	}
+
+	outConfigs := []TickFileConfig{WithDataType(typ)}
+	if tags != nil {
+		outConfigs = append(outConfigs, WithTags(tags))
+	}
+	if nameValues != nil {
+		outConfigs = append(outConfigs, WithNameValues(nameValues))
+	}
+	if description != nil {
+		outConfigs = append(outConfigs, WithContentDescription(*description))
+	}
+	if first != nil && first.blockSection != nil {
+		outConfigs = append(outConfigs,
+			WithColumnarLayout(int(first.blockSection.BlockSize)),
+			WithBlockCompression(first.blockSection.Compression))
+	}
+	outConfigs = append(outConfigs, c.configs...)
+
+	out, err := Create(dst, outConfigs...)
+	if err != nil {
+		return fmt.Errorf("error creating compacted file: %w", err)
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("error closing compacted file: %w", cerr)
+		}
+	}()
+
+	type sourceItem struct {
+		source int
+		item   string
+	}
+	size := int(typ.Size())
+	m := MergeReaders(readers...)
+	// Number of times each item of the tick was written, and was read from
+	// each source
+	written := make(map[string]int)
+	read := make(map[sourceItem]int)
+	var buf []byte
+	var lastTick uint64
+	idx, tick, deltas, err := m.Next()
+	for err == nil {
+		if tick != lastTick {
+			written = make(map[string]int)
+			read = make(map[sourceItem]int)
+			lastTick = tick
+		}
+		group := unsafeBytes(deltas.Pointer, deltas.Len*size)
+		buf = buf[:0]
+		for i := 0; i < deltas.Len; i++ {
+			item := string(group[i*size : (i+1)*size])
+			key := sourceItem{source: idx, item: item}
+			read[key] += 1
+			if read[key] > written[item] {
+				written[item] += 1
+				buf = append(buf, item...)
+			}
+		}
+		if len(buf) > 0 {
+			if err := out.Write(tick, TickDeltas{Pointer: unsafe.Pointer(&buf[0]), Len: len(buf) / size}); err != nil {
+				return fmt.Errorf("error writing to compacted file: %w", err)
+			}
+		}
+		idx, tick, deltas, err = m.Next()
+	}
+	if err != io.EOF {
+		return fmt.Errorf("error reading sources: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package gotickfile
+
+import (
+	"fmt"
+	"github.com/melaurent/kafero"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestCompact(t *testing.T) {
+	// Two recordings sharing items [50, 60)
+	var ticks []uint64
+	var goldenDeltas []Data
+	for i := 0; i < 100; i++ {
+		tick := uint64(i / 2)
+		ticks = append(ticks, tick)
+		goldenDeltas = append(goldenDeltas, Data{Time: tick, Price: uint32(i)})
+	}
+	writeFragment := func(name string, items []Data, tags map[string]string) {
+		file, err := fs.Create(name)
+		if err != nil {
+			t.Fatalf("error creating file")
+		}
+		tf, err := Create(file, WithDataType(reflect.TypeOf(Data{})), WithTags(tags))
+		if err != nil {
+			t.Fatalf("error creating tickfile: %v", err)
+		}
+		for i := range items {
+			if err := tf.Write(items[i].Time, TickDeltas{Pointer: unsafe.Pointer(&items[i]), Len: 1}); err != nil {
+				t.Fatalf("error writing: %v", err)
+			}
+		}
+		if err := tf.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Written in reverse order
+	writeFragment("fragment1.tick", goldenDeltas[50:], map[string]string{"exchange": "NYSE", "session": "2"})
+	writeFragment("fragment0.tick", goldenDeltas[:60], map[string]string{"exchange": "NYSE", "session": "1"})
+
+	compact := func(configs ...CompactConfig) (*TickFile, error) {
+		var srcs []kafero.File
+		for _, name := range []string{"fragment1.tick", "fragment0.tick"} {
+			file, err := fs.Open(name)
+			if err != nil {
+				t.Fatalf("error opening file: %v", err)
+			}
+			srcs = append(srcs, file)
+		}
+		dst, err := fs.Create("compacted.tick")
+		if err != nil {
+			t.Fatalf("error creating file")
+		}
+		if err := Compact(dst, srcs, reflect.TypeOf(Data{}), configs...); err != nil {
+			return nil, err
+		}
+		return OpenRead(dst, reflect.TypeOf(Data{}))
+	}
+
+	if _, err := compact(WithMergePolicy(MERGE_STRICT)); err == nil {
+		t.Fatalf("was expecting an error for conflicting tags")
+	}
+
+	tf, err := compact(WithMergePolicy(MERGE_LAST))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tf.GetTags()["session"] != "1" || tf.GetTags()["exchange"] != "NYSE" {
+		t.Fatalf("got unexpected tags: %v", tf.GetTags())
+	}
+	reader, err := tf.GetTickReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReader(t, reader, ticks, goldenDeltas, func(d Data) Data { return d })
+}
+
+func TestCompactPartialOverlap(t *testing.T) {
+	// Groups of tick 1 and 2 partially overlap, the first source has two
+	// identical items at tick 2
+	sources := [][]Data{
+		{{Time: 0, Price: 0}, {Time: 1, Price: 1}, {Time: 1, Price: 2}, {Time: 2, Price: 3}, {Time: 2, Price: 3}},
+		{{Time: 1, Price: 2}, {Time: 1, Price: 4}, {Time: 2, Price: 3}, {Time: 2, Price: 5}, {Time: 3, Price: 6}},
+	}
+	goldenDeltas := []Data{
+		{Time: 0, Price: 0},
+		{Time: 1, Price: 1}, {Time: 1, Price: 2}, {Time: 1, Price: 4},
+		{Time: 2, Price: 3}, {Time: 2, Price: 3}, {Time: 2, Price: 5},
+		{Time: 3, Price: 6},
+	}
+	var srcs []kafero.File
+	for i, items := range sources {
+		tf, err := CreateInMemory(WithDataType(reflect.TypeOf(Data{})))
+		if err != nil {
+			t.Fatalf("error creating tickfile: %v", err)
+		}
+		// Items of a tick written in one group
+		for j := 0; j < len(items); {
+			k := j
+			for k < len(items) && items[k].Time == items[j].Time {
+				k += 1
+			}
+			if err := tf.Write(items[j].Time, TickDeltas{Pointer: unsafe.Pointer(&items[j]), Len: k - j}); err != nil {
+				t.Fatalf("error writing: %v", err)
+			}
+			j = k
+		}
+		if err := tf.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := tf.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := fs.Create(fmt.Sprintf("overlap%d.tick", i))
+		if err != nil {
+			t.Fatalf("error creating file")
+		}
+		if _, err := file.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		srcs = append(srcs, file)
+	}
+	dst, err := fs.Create("overlap.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	if err := Compact(dst, srcs, reflect.TypeOf(Data{})); err != nil {
+		t.Fatalf("error compacting: %v", err)
+	}
+	tf, err := OpenRead(dst, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := tf.GetTickReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ticks []uint64
+	for _, d := range goldenDeltas {
+		ticks = append(ticks, d.Time)
+	}
+	checkReader(t, reader, ticks, goldenDeltas, func(d Data) Data { return d })
+}
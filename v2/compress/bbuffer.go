@@ -62,6 +62,11 @@ func (b *BBuffer) Bytes() []byte {
 	return b.b
 }
 
+// BitLen returns the number of bits written
+func (b *BBuffer) BitLen() int64 {
+	return int64(len(b.b))*8 - int64(b.count)
+}
+
 func (b *BBuffer) WriteBit(bit bit) {
 	if b.count == 0 {
 		b.b = append(b.b, 0)
@@ -226,6 +231,9 @@ type BitReader struct {
 	buffer *BBuffer
 	count  uint8
 	idx    int
+	// Source of a stream reader, until it is exhausted
+	src    io.Reader
+	srcErr error
 }
 
 type BitReaderState struct {
@@ -241,6 +249,92 @@ func NewBitReader(buf *BBuffer) *BitReader {
 	}
 }
 
+// Number of bytes kept ahead of a stream reader, the end value of a tick
+// stream is in the last two bytes
+const streamLookahead = 2
+
+// NewStreamBitReader returns a reader pulling the bits of a tick stream from
+// src through a rolling buffer of size bytes. The end value written by
+// TickCompress.Close is removed when src is exhausted. The bytes read are
+// dropped from the buffer, so the states of the reader can't be restored.
+func NewStreamBitReader(src io.Reader, size int) *BitReader {
+	if size <= streamLookahead {
+		size = streamLookahead + 1
+	}
+	return &BitReader{
+		buffer: NewBBuffer(make([]byte, 0, size), 0),
+		idx:    0,
+		count:  8,
+		src:    src,
+	}
+}
+
+// Err returns the error of the source of a stream reader, if any
+func (b *BitReader) Err() error {
+	return b.srcErr
+}
+
+// loaded returns true if the byte at idx is in the buffer, pulling more
+// bytes from the source of a stream reader
+func (b *BitReader) loaded() bool {
+	if b.src != nil && b.idx+streamLookahead >= len(b.buffer.b) {
+		b.fill()
+	}
+	return b.idx < len(b.buffer.b)
+}
+
+func (b *BitReader) fill() {
+	buf := b.buffer
+	buf.Lock()
+	defer buf.Unlock()
+	// Drop the bytes read
+	buf.b = buf.b[:copy(buf.b, buf.b[b.idx:])]
+	b.idx = 0
+	for b.src != nil && len(buf.b) <= streamLookahead {
+		n, err := b.src.Read(buf.b[len(buf.b):cap(buf.b)])
+		buf.b = buf.b[:len(buf.b)+n]
+		if err != nil {
+			b.src = nil
+			if err != io.EOF {
+				b.srcErr = err
+			} else if len(buf.b) > 0 {
+				count, ok := EndCount(buf.b)
+				if !ok {
+					b.srcErr = io.ErrUnexpectedEOF
+				} else {
+					// Remove the end value
+					buf.count = 0
+					buf.Rewind(int(count) + 5)
+				}
+			}
+		}
+	}
+}
+
+// NewBitReaderAt returns a reader positioned after the first nbits bits
+func NewBitReaderAt(buf *BBuffer, nbits int64) *BitReader {
+	br := &BitReader{
+		buffer: buf,
+		idx:    int(nbits / 8),
+		count:  8 - uint8(nbits%8),
+	}
+	if br.count == 8 && br.idx > 0 {
+		// Stay on the last byte read
+		br.idx -= 1
+		br.count = 0
+	}
+	return br
+}
+
+// ResetBuffer makes the reader read buf from its start
+func (b *BitReader) ResetBuffer(buf *BBuffer) {
+	*b = BitReader{
+		buffer: buf,
+		idx:    0,
+		count:  8,
+	}
+}
+
 func (b *BitReader) State() BitReaderState {
 	return BitReaderState{
 		idx:   b.idx,
@@ -248,12 +342,18 @@ func (b *BitReader) State() BitReaderState {
 	}
 }
 
+// Bits returns the number of bits read by a reader in the state
+func (s BitReaderState) Bits() int64 {
+	return int64(s.idx)*8 + int64(8-s.count)
+}
+
 func (b *BitReader) Reset(state BitReaderState) {
 	b.idx = state.idx
 	b.count = state.count
 }
 
 func (b *BitReader) End() bool {
+	b.loaded()
 	b.buffer.RLock()
 	defer b.buffer.RUnlock()
 	N := len(b.buffer.b)
@@ -283,14 +383,14 @@ func (b *BitReader) Rewind(nbits uint) {
 
 func (b *BitReader) ReadBit() (bit, error) {
 
-	if len(b.buffer.b) == b.idx {
+	if !b.loaded() {
 		return false, io.EOF
 	}
 
 	if b.count == 0 {
 		b.idx += 1
 		// did we just run out of stuff to read?
-		if len(b.buffer.b) == b.idx {
+		if !b.loaded() {
 			return false, io.EOF
 		}
 		b.count = 8
@@ -304,13 +404,13 @@ func (b *BitReader) ReadBit() (bit, error) {
 
 func (b *BitReader) ReadByte() (byte, error) {
 
-	if len(b.buffer.b) == b.idx {
+	if !b.loaded() {
 		return 0, io.EOF
 	}
 
 	if b.count == 0 {
 		b.idx += 1
-		if len(b.buffer.b) == b.idx {
+		if !b.loaded() {
 			return 0, io.EOF
 		}
 		b.count = 8
@@ -323,7 +423,7 @@ func (b *BitReader) ReadByte() (byte, error) {
 
 	byt2 := byt
 	b.idx += 1
-	if len(b.buffer.b) == b.idx {
+	if !b.loaded() {
 		return 0, io.EOF
 	}
 	byt = b.buffer.b[b.idx]
@@ -339,12 +439,12 @@ func (b *BitReader) ReadBytes(n int) ([]byte, error) {
 }
 
 func (b *BitReader) ReadBytesInto(res []byte) ([]byte, error) {
-	if len(b.buffer.b) == b.idx {
+	if !b.loaded() {
 		return nil, io.EOF
 	}
 	if b.count == 0 {
 		b.idx += 1
-		if len(b.buffer.b) == b.idx {
+		if !b.loaded() {
 			return nil, io.EOF
 		}
 		b.count = 8
@@ -352,7 +452,7 @@ func (b *BitReader) ReadBytesInto(res []byte) ([]byte, error) {
 	if b.count == 8 {
 		// It's our lucky day, no bit operation needed
 		for i := 0; i < len(res); i++ {
-			if len(b.buffer.b) == b.idx {
+			if !b.loaded() {
 				return nil, io.EOF
 			}
 			res[i] = b.buffer.b[b.idx]
@@ -362,7 +462,7 @@ func (b *BitReader) ReadBytesInto(res []byte) ([]byte, error) {
 	} else {
 		// Need to do some butchering
 		for i := 0; i < len(res); i++ {
-			if b.idx >= len(b.buffer.b)-1 {
+			if !b.loaded() || b.idx >= len(b.buffer.b)-1 {
 				return nil, io.EOF
 			}
 			res[i] = b.buffer.b[b.idx] << (8 - b.count)
@@ -398,7 +498,7 @@ func (b *BitReader) ReadBits(nbits int) (uint64, error) {
 		u = (u << uint(b.count)) | uint64(byt>>(8-b.count))
 		nbits -= int(b.count)
 		b.idx += 1
-		if len(b.buffer.b) == b.idx {
+		if !b.loaded() {
 			return 0, io.EOF
 		}
 		b.count = 8
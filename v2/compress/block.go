@@ -0,0 +1,106 @@
+package compress
+
+import (
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"sync"
+)
+
+// Block compressions are applied on whole encoded streams, on top of the
+// bit level compressions.
+const (
+	NoneBlockCompressType uint8 = 0
+	ZstdBlockCompressType uint8 = 1
+	LZ4BlockCompressType  uint8 = 2
+)
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+func zstdCodec() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	})
+	return zstdEncoder, zstdDecoder, zstdErr
+}
+
+// CompressBlock compresses src with the given block compression. If the
+// compressed block is not smaller than src, src is returned, so a block
+// having the same size as its source is stored uncompressed.
+func CompressBlock(version uint8, src []byte) ([]byte, error) {
+	var dst []byte
+	switch version {
+	case NoneBlockCompressType:
+		return src, nil
+	case ZstdBlockCompressType:
+		enc, _, err := zstdCodec()
+		if err != nil {
+			return nil, err
+		}
+		dst = enc.EncodeAll(src, nil)
+	case LZ4BlockCompressType:
+		var c lz4.Compressor
+		dst = make([]byte, lz4.CompressBlockBound(len(src)))
+		n, err := c.CompressBlock(src, dst)
+		if err != nil {
+			return nil, err
+		}
+		dst = dst[:n]
+		if n == 0 {
+			// Incompressible
+			return src, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown block compression %d", version)
+	}
+	if len(dst) >= len(src) {
+		return src, nil
+	}
+	return dst, nil
+}
+
+// DecompressBlock decompresses a block compressed with CompressBlock,
+// rawSize being the size of the source block.
+func DecompressBlock(version uint8, src []byte, rawSize int) ([]byte, error) {
+	if len(src) == rawSize {
+		return src, nil
+	}
+	switch version {
+	case NoneBlockCompressType:
+		return nil, fmt.Errorf("got block of %d bytes, was expecting %d", len(src), rawSize)
+	case ZstdBlockCompressType:
+		_, dec, err := zstdCodec()
+		if err != nil {
+			return nil, err
+		}
+		dst, err := dec.DecodeAll(src, make([]byte, 0, rawSize))
+		if err != nil {
+			return nil, err
+		}
+		if len(dst) != rawSize {
+			return nil, fmt.Errorf("got block of %d bytes, was expecting %d", len(dst), rawSize)
+		}
+		return dst, nil
+	case LZ4BlockCompressType:
+		dst := make([]byte, rawSize)
+		n, err := lz4.UncompressBlock(src, dst)
+		if err != nil {
+			return nil, err
+		}
+		if n != rawSize {
+			return nil, fmt.Errorf("got block of %d bytes, was expecting %d", n, rawSize)
+		}
+		return dst, nil
+	default:
+		return nil, fmt.Errorf("unknown block compression %d", version)
+	}
+}
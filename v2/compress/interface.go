@@ -4,6 +4,7 @@ import "unsafe"
 
 type Compress interface {
 	Compress(*BBuffer, unsafe.Pointer)
+	MarshalState() []byte
 }
 
 type Decompress interface {
@@ -25,9 +26,9 @@ func GetCompress(bw *BBuffer, val unsafe.Pointer, size uint32, version uint8) Co
 	case NoneCompressType:
 		return NewNoneCompress(bw, val, size)
 	case Uint8GorillaCompressType:
-		return NewUInt8GorillaCompress(bw, *(*uint64)(val))
+		return NewUInt8GorillaCompress(bw, uint64(*(*uint8)(val)))
 	case Uint32GorillaCompressType:
-		return NewUInt32GorillaCompress(bw, *(*uint64)(val))
+		return NewUInt32GorillaCompress(bw, uint64(*(*uint32)(val)))
 	case Uint64GorillaCompressType:
 		return NewUInt64GorillaCompress(bw, *(*uint64)(val))
 	case Bytes32RunLengthByteCompressType:
@@ -0,0 +1,196 @@
+package compress
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// The state of a compressor can be saved with MarshalState and restored
+// with DecompressFromState, to continue decoding a stream from the middle.
+// States are little endian.
+
+const TickStateSize = 16
+
+const gorillaStateSize = 10
+
+// StateSize returns the size of the state of a compressor
+func StateSize(version uint8, size uint32) int {
+	switch version {
+	case Uint8GorillaCompressType, Uint32GorillaCompressType, Uint64GorillaCompressType:
+		return gorillaStateSize
+	case Bytes32RunLengthByteCompressType:
+		return 32
+	case Bytes256RunLengthByteCompressType:
+		return 256
+	default:
+		return 0
+	}
+}
+
+// DecompressFromState returns a decompressor with the state saved by the
+// MarshalState method of the compressor
+func DecompressFromState(state []byte, size uint32, version uint8) (Decompress, error) {
+	if len(state) != StateSize(version, size) {
+		return nil, fmt.Errorf("got state of %d bytes, was expecting %d", len(state), StateSize(version, size))
+	}
+	switch version {
+	case NoneCompressType:
+		return &NoneDecompress{size: size}, nil
+	case Uint8GorillaCompressType:
+		return &UInt8GorillaDecompress{
+			lastVal:  uint8(binary.LittleEndian.Uint64(state)),
+			leading:  state[8],
+			trailing: state[9],
+		}, nil
+	case Uint32GorillaCompressType:
+		return &UInt32GorillaDecompress{
+			lastVal:  uint32(binary.LittleEndian.Uint64(state)),
+			leading:  state[8],
+			trailing: state[9],
+		}, nil
+	case Uint64GorillaCompressType:
+		return &UInt64GorillaDecompress{
+			lastVal:  binary.LittleEndian.Uint64(state),
+			leading:  state[8],
+			trailing: state[9],
+		}, nil
+	case Bytes32RunLengthByteCompressType:
+		d := &Bytes32RunLengthByteDecompress{}
+		copy(d.lastVal[:], state)
+		return d, nil
+	case Bytes256RunLengthByteCompressType:
+		d := &Bytes256RunLengthByteDecompress{}
+		copy(d.lastVal[:], state)
+		return d, nil
+	default:
+		return nil, fmt.Errorf("unknown compression version %d", version)
+	}
+}
+
+func gorillaState(lastVal uint64, leading, trailing uint8) []byte {
+	return appendGorillaState(make([]byte, 0, gorillaStateSize), lastVal, leading, trailing)
+}
+
+func appendGorillaState(dst []byte, lastVal uint64, leading, trailing uint8) []byte {
+	var state [gorillaStateSize]byte
+	binary.LittleEndian.PutUint64(state[:], lastVal)
+	state[8] = leading
+	state[9] = trailing
+	return append(dst, state[:]...)
+}
+
+// AppendState appends the state of a decompressor to dst, it is the state
+// returned by the MarshalState method of its compressor. Unlike
+// MarshalState, it does not allocate if dst is large enough.
+func AppendState(dst []byte, d Decompress) []byte {
+	switch d := d.(type) {
+	case *UInt8GorillaDecompress:
+		return appendGorillaState(dst, uint64(d.lastVal), d.leading, d.trailing)
+	case *UInt32GorillaDecompress:
+		return appendGorillaState(dst, uint64(d.lastVal), d.leading, d.trailing)
+	case *UInt64GorillaDecompress:
+		return appendGorillaState(dst, d.lastVal, d.leading, d.trailing)
+	case *Bytes32RunLengthByteDecompress:
+		return append(dst, d.lastVal[:]...)
+	case *Bytes256RunLengthByteDecompress:
+		return append(dst, d.lastVal[:]...)
+	default:
+		return dst
+	}
+}
+
+// RestoreState sets the state of a decompressor to a state appended by
+// AppendState, or marshaled by MarshalState, for the same compression
+func RestoreState(d Decompress, state []byte) error {
+	var size int
+	switch d.(type) {
+	case *UInt8GorillaDecompress, *UInt32GorillaDecompress, *UInt64GorillaDecompress:
+		size = gorillaStateSize
+	case *Bytes32RunLengthByteDecompress:
+		size = 32
+	case *Bytes256RunLengthByteDecompress:
+		size = 256
+	}
+	if len(state) != size {
+		return fmt.Errorf("got state of %d bytes, was expecting %d", len(state), size)
+	}
+	switch d := d.(type) {
+	case *UInt8GorillaDecompress:
+		d.lastVal = uint8(binary.LittleEndian.Uint64(state))
+		d.leading, d.trailing = state[8], state[9]
+	case *UInt32GorillaDecompress:
+		d.lastVal = uint32(binary.LittleEndian.Uint64(state))
+		d.leading, d.trailing = state[8], state[9]
+	case *UInt64GorillaDecompress:
+		d.lastVal = binary.LittleEndian.Uint64(state)
+		d.leading, d.trailing = state[8], state[9]
+	case *Bytes32RunLengthByteDecompress:
+		copy(d.lastVal[:], state)
+	case *Bytes256RunLengthByteDecompress:
+		copy(d.lastVal[:], state)
+	}
+	return nil
+}
+
+func (c *NoneCompress) MarshalState() []byte {
+	return nil
+}
+
+func (c *UInt8GorillaCompress) MarshalState() []byte {
+	return gorillaState(uint64(c.lastVal), c.leading, c.trailing)
+}
+
+func (c *UInt32GorillaCompress) MarshalState() []byte {
+	return gorillaState(uint64(c.lastVal), c.leading, c.trailing)
+}
+
+func (c *UInt64GorillaCompress) MarshalState() []byte {
+	return gorillaState(c.lastVal, c.leading, c.trailing)
+}
+
+func (c *Bytes32RunLengthByteCompress) MarshalState() []byte {
+	return append([]byte(nil), c.lastVal[:]...)
+}
+
+func (c *Bytes256RunLengthByteCompress) MarshalState() []byte {
+	return append([]byte(nil), c.lastVal[:]...)
+}
+
+func (c *TickCompress) MarshalState() []byte {
+	state := make([]byte, TickStateSize)
+	binary.LittleEndian.PutUint64(state, c.lastVal)
+	binary.LittleEndian.PutUint64(state[8:], uint64(c.lastDelta))
+	return state
+}
+
+// TickDecompressFromState returns a tick decompressor with the state saved
+// by the MarshalState method of the compressor
+func TickDecompressFromState(state []byte) (*TickDecompress, error) {
+	if len(state) != TickStateSize {
+		return nil, fmt.Errorf("got state of %d bytes, was expecting %d", len(state), TickStateSize)
+	}
+	return &TickDecompress{
+		lastVal:   binary.LittleEndian.Uint64(state),
+		lastDelta: int64(binary.LittleEndian.Uint64(state[8:])),
+	}, nil
+}
+
+// AppendState appends the state of the decompressor to dst, it is the state
+// returned by the MarshalState method of its compressor
+func (d *TickDecompress) AppendState(dst []byte) []byte {
+	var state [TickStateSize]byte
+	binary.LittleEndian.PutUint64(state[:], d.lastVal)
+	binary.LittleEndian.PutUint64(state[8:], uint64(d.lastDelta))
+	return append(dst, state[:]...)
+}
+
+// RestoreState sets the state of the decompressor to a state appended by
+// AppendState, or marshaled by MarshalState
+func (d *TickDecompress) RestoreState(state []byte) error {
+	if len(state) != TickStateSize {
+		return fmt.Errorf("got state of %d bytes, was expecting %d", len(state), TickStateSize)
+	}
+	d.lastVal = binary.LittleEndian.Uint64(state)
+	d.lastDelta = int64(binary.LittleEndian.Uint64(state[8:]))
+	return nil
+}
@@ -55,6 +55,35 @@ func (c *TickCompress) Close(bw *BBuffer) {
 	bw.WriteBits(0x1f, 5)
 }
 
+// EndCount returns the number of bits following the end value written by
+// Close at the end of the block, false if the block has no end value.
+func EndCount(block []byte) (uint8, bool) {
+	// Look for EOF value in block
+	// look in the last byte
+	// XXX11111 -> count = 0
+	// XX111110 -> count = 1
+	// X1111100 -> count = 2
+	// 11111000 -> count = 3
+	// XXXXXXX1 11110000 -> count = 4
+	// XXXXXX11 11100000 -> count = 5
+	// XXXXX111 11000000 -> count = 6
+	// XXXX1111 10000000 -> count = 7
+	var v uint16
+	N := len(block)
+	if N > 1 {
+		v = uint16(block[N-2])<<8 | uint16(block[N-1])
+	} else {
+		v = uint16(block[N-1])
+	}
+
+	var count uint8 = 0
+	for v != 0 && v&0x1F != 0x1F {
+		v >>= 1
+		count += 1
+	}
+	return count, v != 0
+}
+
 type TickDecompress struct {
 	lastVal   uint64
 	lastDelta int64
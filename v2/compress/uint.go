@@ -157,7 +157,7 @@ func NewUInt32GorillaCompress(bw *BBuffer, val uint64) *UInt32GorillaCompress {
 }
 
 func (c *UInt32GorillaCompress) Compress(bw *BBuffer, vali unsafe.Pointer) {
-	val := uint32(*(*uint64)(vali))
+	val := *(*uint32)(vali)
 	xor := val ^ c.lastVal
 	if xor == 0 {
 		bw.WriteBit(Zero)
@@ -289,7 +289,7 @@ func NewUInt8GorillaCompress(bw *BBuffer, val uint64) *UInt8GorillaCompress {
 }
 
 func (c *UInt8GorillaCompress) Compress(bw *BBuffer, vali unsafe.Pointer) {
-	val := uint8(*(*uint64)(vali))
+	val := *(*uint8)(vali)
 	xor := val ^ c.lastVal
 	if xor == 0 {
 		bw.WriteBit(Zero)
@@ -179,3 +179,36 @@ func WithTags(tags map[string]string) TickFileConfig {
 		}
 	}
 }
+
+// WithColumnarLayout stores the items in blocks of about blockSize items,
+// each field of a block being compressed in its own contiguous stream, so
+// readers can decode only the fields they need.
+func WithColumnarLayout(blockSize int) TickFileConfig {
+	return func(tf *TickFile) {
+		if blockSize <= 0 {
+			panic(fmt.Sprintf("invalid block size: %d", blockSize))
+		}
+		if tf.blockSection == nil {
+			tf.blockSection = &BlockSection{}
+		}
+		tf.blockSection.Layout = COLUMNAR_LAYOUT
+		tf.blockSection.BlockSize = uint32(blockSize)
+	}
+}
+
+// WithBlockCompression compresses each column of the blocks of a columnar
+// file with the given block compression, one of the compress package
+// block compress types.
+func WithBlockCompression(compression uint8) TickFileConfig {
+	return func(tf *TickFile) {
+		switch compression {
+		case compress.NoneBlockCompressType, compress.ZstdBlockCompressType, compress.LZ4BlockCompressType:
+		default:
+			panic(fmt.Sprintf("unknown block compression: %d", compression))
+		}
+		if tf.blockSection == nil {
+			tf.blockSection = &BlockSection{}
+		}
+		tf.blockSection.Compression = compression
+	}
+}
@@ -7,6 +7,9 @@ import (
 
 const (
 	ITEM_SECTION_ID                int32 = 0x0a
+	BLOCK_SECTION_ID               int32 = 0x0b
+	CHECKPOINT_SECTION_ID          int32 = 0x0c
+	ITEM_INDEX_SECTION_ID          int32 = 0x0d
 	CONTENT_DESCRIPTION_SECTION_ID int32 = 0x80
 	NAME_VALUE_SECTION_ID          int32 = 0x81
 	TAGS_SECTION_ID                int32 = 0x82
@@ -29,6 +32,9 @@ const (
 	FLOAT32 uint8 = 9
 	FLOAT64 uint8 = 10
 	ARRAY   uint8 = 11
+
+	STREAM_LAYOUT   uint8 = 0
+	COLUMNAR_LAYOUT uint8 = 1
 )
 
 var fieldTypeToKind = map[uint8]reflect.Kind{
@@ -0,0 +1,57 @@
+package gotickfile
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+const (
+	// Size of the reads of OpenReadContext
+	contextReadChunkSize = 1 << 20
+	// Number of tick groups decoded between two context checks
+	contextCheckInterval = 1024
+)
+
+// readAllContext reads r until EOF by chunks, checking the context between
+// them.
+func readAllContext(ctx context.Context, r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n, err := io.CopyN(&buf, r, contextReadChunkSize)
+		if err == io.EOF || (err == nil && n < contextReadChunkSize) {
+			return buf.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// NextContext is like Next, but returns the context error if the context
+// is done, checking it while skipping the groups and the blocks filtered
+// out.
+func (r *CTickReader) NextContext(ctx context.Context) (uint64, TickDeltas, error) {
+	if err := ctx.Err(); err != nil {
+		return r.tick, TickDeltas{Pointer: nil, Len: 0}, err
+	}
+	tick, delta, err := r.nextDeltas(ctx)
+	if r.copy && delta.Len > 0 {
+		delta = r.copyDeltas(delta)
+	}
+	return tick, delta, err
+}
+
+// NextContext is like Next, but returns the context error if the context
+// is done, and opens the partitions with OpenReadContext.
+func (r *StoreReader) NextContext(ctx context.Context) (uint64, TickDeltas, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, TickDeltas{}, err
+	}
+	r.ctx = ctx
+	defer func() { r.ctx = nil }()
+	return r.Next()
+}
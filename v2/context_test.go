@@ -0,0 +1,98 @@
+package gotickfile
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestOpenReadContext(t *testing.T) {
+	file, err := fs.Create("context.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	tf, err := Create(file, WithDataType(reflect.TypeOf(Data{})))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	for i := 0; i < 5000; i++ {
+		delta := Data{Time: uint64(i), Price: uint32(i)}
+		if err := tf.Write(uint64(i), TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tf, err = OpenReadContext(ctx, file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	if tf.LastTick() != 4999 {
+		t.Fatalf("got different last tick: %d", tf.LastTick())
+	}
+	reader, err := tf.GetTickReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := reader.NextContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if _, _, err := reader.NextContext(ctx); err != context.Canceled {
+		t.Fatalf("was expecting context canceled error, got %v", err)
+	}
+	if _, err := OpenReadContext(ctx, file, reflect.TypeOf(Data{})); err == nil {
+		t.Fatalf("was expecting an error with a canceled context")
+	}
+}
+
+// countdownContext is done once its Err method was called n times
+type countdownContext struct {
+	context.Context
+	n int
+}
+
+func (c *countdownContext) Err() error {
+	if c.n == 0 {
+		return context.Canceled
+	}
+	c.n -= 1
+	return nil
+}
+
+func TestNextContextFiltered(t *testing.T) {
+	for _, configs := range [][]TickFileConfig{nil, {WithColumnarLayout(100)}} {
+		tf, err := CreateInMemory(append([]TickFileConfig{WithDataType(reflect.TypeOf(Data{}))}, configs...)...)
+		if err != nil {
+			t.Fatalf("error creating tickfile: %v", err)
+		}
+		for i := 0; i < 100000; i++ {
+			delta := Data{Time: uint64(i), Price: uint32(i % 1000)}
+			if err := tf.Write(uint64(i), TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+				t.Fatalf("error writing: %v", err)
+			}
+		}
+		if err := tf.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		// No item matches, the context is done during the scan
+		reader, err := tf.GetTickReader(WithFilter("Price", FILTER_GT, uint32(1000)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := &countdownContext{Context: context.Background(), n: 5}
+		if _, _, err := reader.NextContext(ctx); err != context.Canceled {
+			t.Fatalf("was expecting context canceled error, got %v", err)
+		}
+		// The scan can be continued
+		if _, _, err := reader.NextContext(context.Background()); err != io.EOF {
+			t.Fatalf("was expecting EOF, got %v", err)
+		}
+	}
+}
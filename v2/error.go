@@ -3,8 +3,11 @@ package gotickfile
 import "errors"
 
 var (
-	ErrTickOutOfOrder = errors.New("tick out of order not supported")
-	ErrReadOnly       = errors.New("tickfile is in readonly")
-	ErrReadTimeout    = errors.New("read timeout")
-	ErrTickFileV1     = errors.New("tickfile V1 not supported")
+	ErrTickOutOfOrder   = errors.New("tick out of order not supported")
+	ErrReadOnly         = errors.New("tickfile is in readonly")
+	ErrReadTimeout      = errors.New("read timeout")
+	ErrTickFileV1       = errors.New("tickfile V1 not supported")
+	ErrForeignByteOrder = errors.New("tickfile byte order is not the native one")
+	ErrClosed           = errors.New("tickfile is closed")
+	ErrInvalidKey       = errors.New("invalid store key")
 )
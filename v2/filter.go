@@ -0,0 +1,344 @@
+package gotickfile
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"unsafe"
+)
+
+type FilterOp uint8
+
+const (
+	FILTER_EQ FilterOp = iota
+	FILTER_NE
+	FILTER_LT
+	FILTER_LE
+	FILTER_GT
+	FILTER_GE
+)
+
+type TickReaderConfig func(r *CTickReader)
+
+// WithFilter only returns the items whose field compares to value with op.
+// Value can be of any integer or float type. In a columnar file, the
+// blocks whose statistics can't match are skipped without being decoded.
+func WithFilter(field string, op FilterOp, value interface{}) TickReaderConfig {
+	return func(r *CTickReader) {
+		r.filters = append(r.filters, fieldFilter{
+			name:  field,
+			op:    op,
+			value: value,
+		})
+	}
+}
+
+// WithTickRange only returns the ticks in [from, to).
+func WithTickRange(from, to uint64) TickReaderConfig {
+	return func(r *CTickReader) {
+		r.from = from
+		r.to = to
+		r.ranged = true
+	}
+}
+
+// WithFields only decodes the given fields in a columnar file, the other
+// fields are zeroed. The fields used by filters are decoded as well.
+func WithFields(fields ...string) TickReaderConfig {
+	return func(r *CTickReader) {
+		r.fields = append(r.fields, fields...)
+	}
+}
+
+type fieldFilter struct {
+	name  string
+	op    FilterOp
+	value interface{}
+	field int
+	num   number
+}
+
+const (
+	intNumber uint8 = iota
+	uintNumber
+	floatNumber
+)
+
+// number holds the value of a numeric field
+type number struct {
+	kind uint8
+	i    int64
+	u    uint64
+	f    float64
+}
+
+func (n number) isNaN() bool {
+	return n.kind == floatNumber && math.IsNaN(n.f)
+}
+
+func (n number) Float64() float64 {
+	switch n.kind {
+	case intNumber:
+		return float64(n.i)
+	case uintNumber:
+		return float64(n.u)
+	default:
+		return n.f
+	}
+}
+
+func toNumber(value interface{}) (number, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return number{kind: intNumber, i: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return number{kind: uintNumber, u: v.Uint()}, nil
+	case reflect.Float32, reflect.Float64:
+		return number{kind: floatNumber, f: v.Float()}, nil
+	default:
+		return number{}, fmt.Errorf("unsupported filter value type: %T", value)
+	}
+}
+
+// fieldNumber reads the value of a field of the given type at ptr
+func fieldNumber(typ uint8, ptr unsafe.Pointer) (number, bool) {
+	switch typ {
+	case INT8:
+		return number{kind: intNumber, i: int64(*(*int8)(ptr))}, true
+	case INT16:
+		return number{kind: intNumber, i: int64(*(*int16)(ptr))}, true
+	case INT32:
+		return number{kind: intNumber, i: int64(*(*int32)(ptr))}, true
+	case INT64:
+		return number{kind: intNumber, i: *(*int64)(ptr)}, true
+	case UINT8:
+		return number{kind: uintNumber, u: uint64(*(*uint8)(ptr))}, true
+	case UINT16:
+		return number{kind: uintNumber, u: uint64(*(*uint16)(ptr))}, true
+	case UINT32:
+		return number{kind: uintNumber, u: uint64(*(*uint32)(ptr))}, true
+	case UINT64:
+		return number{kind: uintNumber, u: *(*uint64)(ptr)}, true
+	case FLOAT32:
+		return number{kind: floatNumber, f: float64(*(*float32)(ptr))}, true
+	case FLOAT64:
+		return number{kind: floatNumber, f: *(*float64)(ptr)}, true
+	default:
+		return number{}, false
+	}
+}
+
+func isNumeric(typ uint8) bool {
+	return typ >= INT8 && typ <= FLOAT64
+}
+
+func encodeNumber(n number) uint64 {
+	switch n.kind {
+	case intNumber:
+		return uint64(n.i)
+	case uintNumber:
+		return n.u
+	default:
+		return math.Float64bits(n.f)
+	}
+}
+
+func decodeNumber(typ uint8, v uint64) number {
+	switch typ {
+	case INT8, INT16, INT32, INT64:
+		return number{kind: intNumber, i: int64(v)}
+	case FLOAT32, FLOAT64:
+		return number{kind: floatNumber, f: math.Float64frombits(v)}
+	default:
+		return number{kind: uintNumber, u: v}
+	}
+}
+
+// compareNumbers returns -1, 0 or 1, and false if the numbers are unordered
+func compareNumbers(a, b number) (int, bool) {
+	if a.kind == floatNumber || b.kind == floatNumber {
+		x, y := a.Float64(), b.Float64()
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		case x == y:
+			return 0, true
+		default:
+			return 0, false
+		}
+	}
+	if a.kind == intNumber && b.kind == uintNumber {
+		if a.i < 0 {
+			return -1, true
+		}
+		a = number{kind: uintNumber, u: uint64(a.i)}
+	} else if a.kind == uintNumber && b.kind == intNumber {
+		if b.i < 0 {
+			return 1, true
+		}
+		b = number{kind: uintNumber, u: uint64(b.i)}
+	}
+	if a.kind == intNumber {
+		switch {
+		case a.i < b.i:
+			return -1, true
+		case a.i > b.i:
+			return 1, true
+		default:
+			return 0, true
+		}
+	}
+	switch {
+	case a.u < b.u:
+		return -1, true
+	case a.u > b.u:
+		return 1, true
+	default:
+		return 0, true
+	}
+}
+
+func (f *fieldFilter) match(n number) bool {
+	c, ok := compareNumbers(n, f.num)
+	if !ok {
+		return f.op == FILTER_NE
+	}
+	switch f.op {
+	case FILTER_EQ:
+		return c == 0
+	case FILTER_NE:
+		return c != 0
+	case FILTER_LT:
+		return c < 0
+	case FILTER_LE:
+		return c <= 0
+	case FILTER_GT:
+		return c > 0
+	case FILTER_GE:
+		return c >= 0
+	default:
+		return false
+	}
+}
+
+// canMatch returns false if no value within the stats can match
+func (f *fieldFilter) canMatch(typ uint8, s fieldStats) bool {
+	if s.count == 0 {
+		// Only NaN values
+		return f.op == FILTER_NE
+	}
+	min, _ := compareNumbers(decodeNumber(typ, s.min), f.num)
+	max, ok := compareNumbers(decodeNumber(typ, s.max), f.num)
+	if !ok {
+		return f.op == FILTER_NE
+	}
+	switch f.op {
+	case FILTER_EQ:
+		return min <= 0 && max >= 0
+	case FILTER_NE:
+		return !(min == 0 && max == 0)
+	case FILTER_LT:
+		return min < 0
+	case FILTER_LE:
+		return min <= 0
+	case FILTER_GT:
+		return max > 0
+	case FILTER_GE:
+		return max >= 0
+	default:
+		return true
+	}
+}
+
+// setupFilters resolves the filters fields against the item section
+func (r *CTickReader) setupFilters() error {
+	for i := range r.filters {
+		f := &r.filters[i]
+		indices, err := r.info.fieldIndices(f.name)
+		if err != nil {
+			return err
+		}
+		if len(indices) != 1 {
+			return fmt.Errorf("cannot filter on array field %s", f.name)
+		}
+		f.field = indices[0]
+		if !isNumeric(r.info.Fields[f.field].Type) {
+			return fmt.Errorf("cannot filter on non numeric field %s", f.name)
+		}
+		f.num, err = toNumber(f.value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// columns returns the fields a columnar reader has to decode
+func (r *CTickReader) columns() ([]int, error) {
+	var names []string
+	if len(r.fields) == 0 {
+		for _, f := range r.info.Fields {
+			names = append(names, f.Name)
+		}
+	} else {
+		names = append(names, r.fields...)
+		for _, f := range r.filters {
+			names = append(names, f.name)
+		}
+	}
+	return r.info.fieldIndices(names...)
+}
+
+func (r *CTickReader) skipBlock(b *columnBlock) bool {
+	if r.ranged && (b.lastTick < r.from || b.firstTick >= r.to) {
+		return true
+	}
+	for i := range r.filters {
+		f := &r.filters[i]
+		if !f.canMatch(r.info.Fields[f.field].Type, b.stats[f.field]) {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the items of the group that match all the filters
+func (r *CTickReader) filter(delta TickDeltas) TickDeltas {
+	size := r.typ.Size()
+	var matches []int
+	for i := 0; i < delta.Len; i++ {
+		ptr := unsafe.Pointer(uintptr(delta.Pointer) + uintptr(i)*size)
+		match := true
+		for j := range r.filters {
+			f := &r.filters[j]
+			field := r.info.Fields[f.field]
+			v, _ := fieldNumber(field.Type, unsafe.Pointer(uintptr(ptr)+uintptr(field.Offset)))
+			if !f.match(v) {
+				match = false
+				break
+			}
+		}
+		if match {
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) == delta.Len {
+		return delta
+	}
+	if len(matches) == 0 {
+		return TickDeltas{Pointer: nil, Len: 0}
+	}
+	if len(r.fval) < len(matches)*int(size) {
+		r.fval = make([]byte, delta.Len*int(size))
+	}
+	for j, i := range matches {
+		copy(r.fval[j*int(size):(j+1)*int(size)], unsafeBytes(unsafe.Pointer(uintptr(delta.Pointer)+uintptr(i)*size), int(size)))
+	}
+	return TickDeltas{
+		Pointer: unsafe.Pointer(&r.fval[0]),
+		Len:     len(matches),
+	}
+}
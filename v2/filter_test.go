@@ -0,0 +1,179 @@
+package gotickfile
+
+import (
+	"io"
+	"math"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+type Quote struct {
+	Bid    float64
+	Ask    float64
+	Volume int32
+}
+
+func writeQuoteFile(t *testing.T, name string, configs ...TickFileConfig) []Quote {
+	file, err := fs.Create(name)
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	configs = append(configs, WithDataType(reflect.TypeOf(Quote{})))
+	tf, err := Create(file, configs...)
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	var quotes []Quote
+	for i := 0; i < 1000; i++ {
+		q := Quote{
+			Bid:    100 + float64(i%10),
+			Ask:    101 + float64(i%10),
+			Volume: int32(i % 7),
+		}
+		if i == 777 {
+			// Spike
+			q.Ask = 250
+			q.Volume = -100
+		}
+		if i == 10 {
+			q.Bid = math.NaN()
+		}
+		if err := tf.Write(uint64(i), TickDeltas{Pointer: unsafe.Pointer(&q), Len: 1}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+		quotes = append(quotes, q)
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return quotes
+}
+
+func readAll(t *testing.T, r *CTickReader) ([]uint64, []Quote) {
+	var ticks []uint64
+	var quotes []Quote
+	tick, delta, err := r.Next()
+	for err == nil {
+		for i := 0; i < delta.Len; i++ {
+			ticks = append(ticks, tick)
+			quotes = append(quotes, *(*Quote)(unsafe.Pointer(uintptr(delta.Pointer) + uintptr(i)*unsafe.Sizeof(Quote{}))))
+		}
+		tick, delta, err = r.Next()
+	}
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+	return ticks, quotes
+}
+
+func TestWithFilter(t *testing.T) {
+	for _, configs := range [][]TickFileConfig{nil, {WithColumnarLayout(100)}} {
+		quotes := writeQuoteFile(t, "quotes.tick", configs...)
+		file, err := fs.Open("quotes.tick")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tf, err := OpenRead(file, reflect.TypeOf(Quote{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reader, err := tf.GetTickReader(WithFilter("Ask", FILTER_GT, 200))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ticks, res := readAll(t, reader)
+		if len(ticks) != 1 || ticks[0] != 777 || res[0] != quotes[777] {
+			t.Fatalf("got different filtered items: %v %v", ticks, res)
+		}
+
+		reader, err = tf.GetTickReader(
+			WithFilter("Volume", FILTER_GE, 5),
+			WithFilter("Bid", FILTER_LT, uint8(104)),
+			WithTickRange(100, 200))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ticks, res = readAll(t, reader)
+		var expected []uint64
+		for i := 100; i < 200; i++ {
+			if quotes[i].Volume >= 5 && quotes[i].Bid < 104 {
+				expected = append(expected, uint64(i))
+			}
+		}
+		if !reflect.DeepEqual(ticks, expected) {
+			t.Fatalf("got different filtered ticks: %v %v", ticks, expected)
+		}
+
+		reader, err = tf.GetTickReader(WithFilter("Bid", FILTER_NE, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ticks, _ = readAll(t, reader)
+		if len(ticks) != 901 {
+			t.Fatalf("was expecting 901 items, got %d", len(ticks))
+		}
+
+		if _, err := tf.GetTickReader(WithFilter("Unknown", FILTER_EQ, 1)); err == nil {
+			t.Fatalf("was expecting an error for an unknown field")
+		}
+		if _, err := tf.GetTickReader(WithFilter("Bid", FILTER_EQ, "1")); err == nil {
+			t.Fatalf("was expecting an error for a non numeric value")
+		}
+	}
+	if err := fs.Remove("quotes.tick"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlockStatsSkip(t *testing.T) {
+	writeQuoteFile(t, "quotes.tick", WithColumnarLayout(100))
+	file, err := fs.Open("quotes.tick")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tf, err := OpenRead(file, reflect.TypeOf(Quote{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := tf.blocks.blocks[7].stats
+	if decodeNumber(FLOAT64, stats[1].max).f != 250 || decodeNumber(INT32, stats[2].min).i != -100 {
+		t.Fatalf("got different block stats: %v", stats)
+	}
+	if stats := tf.blocks.blocks[0].stats; stats[0].count != 99 {
+		t.Fatalf("was expecting NaN to be left out of the stats, got count %d", stats[0].count)
+	}
+
+	reader, err := tf.GetTickReader(WithFilter("Volume", FILTER_LT, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []int
+	for i, b := range tf.blocks.blocks {
+		if !reader.skipBlock(b) {
+			decoded = append(decoded, i)
+		}
+	}
+	if !reflect.DeepEqual(decoded, []int{7}) {
+		t.Fatalf("was expecting only block 7 to be decoded, got %v", decoded)
+	}
+
+	reader, err = tf.GetTickReader(WithTickRange(250, 420))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded = nil
+	for i, b := range tf.blocks.blocks {
+		if !reader.skipBlock(b) {
+			decoded = append(decoded, i)
+		}
+	}
+	if !reflect.DeepEqual(decoded, []int{2, 3, 4}) {
+		t.Fatalf("was expecting blocks 2 to 4 to be decoded, got %v", decoded)
+	}
+	ticks, _ := readAll(t, reader)
+	if len(ticks) != 170 || ticks[0] != 250 || ticks[169] != 419 {
+		t.Fatalf("got different ticks in range")
+	}
+}
@@ -6,5 +6,6 @@ require (
 	github.com/klauspost/compress v1.16.5
 	github.com/melaurent/gotickfile v0.0.0-20210111153942-2a7b4a47af2e
 	github.com/melaurent/kafero v1.2.4-0.20231014071826-4ba38bb93d1b
+	github.com/pierrec/lz4/v4 v4.1.21
 	github.com/satori/go.uuid v1.2.0
 )
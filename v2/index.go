@@ -0,0 +1,377 @@
+package gotickfile
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/melaurent/gotickfile/v2/compress"
+	"io"
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+// Number of items between two entries of the item index, ReadItem decodes
+// at most this many items
+const itemIndexInterval = 1024
+
+// WithItemIndex creates a stream file with an item index section. When the
+// file is closed, the item count and the entries of the item index are
+// written after the data, so opening the file doesn't decode the data to
+// count the items and ReadItem doesn't build the index. The section is not
+// known to the versions of this package before it, which can't open such
+// files.
+func WithItemIndex() TickFileConfig {
+	return func(tf *TickFile) {
+		tf.indexed = true
+	}
+}
+
+// itemIndexEntry is the state of the decoder before an item of the stream
+type itemIndexEntry struct {
+	// Position in the data, in bits
+	bits int64
+	// State of the decompressors, nil before the first item
+	state []byte
+}
+
+// itemIndex is a sparse index of the item stream, with an entry every
+// itemIndexInterval items. It is extended by the writer, by ReadItem as it
+// reaches new items, or loaded from the file.
+type itemIndex struct {
+	sync.Mutex
+	entries []itemIndexEntry
+	// Decoder of the items after the last entry, nil if not positioned
+	br        *compress.BitReader
+	tickDec   *compress.TickDecompress
+	structDec *StructDecompress
+}
+
+// has returns true if the index has an entry for the item at idx
+func (ix *itemIndex) has(idx int) bool {
+	ix.Lock()
+	defer ix.Unlock()
+	return len(ix.entries) > idx/itemIndexInterval
+}
+
+// decodeItem decodes the next item with the decompressors, creating them
+// on the first item
+func (tf *TickFile) decodeItem(br *compress.BitReader, tickDec **compress.TickDecompress, structDec **StructDecompress) (uint64, error) {
+	if *tickDec == nil {
+		td, tick, err := compress.NewTickDecompress(br)
+		if err != nil {
+			return 0, err
+		}
+		sd, _, err := NewStructDecompress(br, tf.itemSection, tf.dataType)
+		if err != nil {
+			return 0, err
+		}
+		*tickDec = td
+		*structDec = sd
+		return tick, nil
+	}
+	tick, err := (*tickDec).Decompress(br)
+	if err != nil {
+		return 0, err
+	}
+	(*structDec).Clear()
+	if _, err := (*structDec).Decompress(br); err != nil {
+		return 0, err
+	}
+	return tick, nil
+}
+
+// indexItem adds the entry of the item index before the item at idx, about
+// to be written, if the index reaches it. The caller holds the lock of the
+// block.
+func (tf *TickFile) indexItem(idx uint64) {
+	if idx == 0 || idx%itemIndexInterval != 0 {
+		return
+	}
+	ix := &tf.itemIndex
+	ix.Lock()
+	defer ix.Unlock()
+	if uint64(len(ix.entries)) != idx/itemIndexInterval {
+		return
+	}
+	ix.entries = append(ix.entries, itemIndexEntry{
+		bits:  tf.dataBase*8 + tf.block.BitLen(),
+		state: marshalState(tf.writer.tickC, tf.writer.structC),
+	})
+	// The decoder is positioned again after the new entry
+	ix.br = nil
+}
+
+// indexEntry returns the entry of the item index before the item at idx,
+// extending the index up to it. The whole data must be loaded.
+func (tf *TickFile) indexEntry(idx int) (itemIndexEntry, error) {
+	ix := &tf.itemIndex
+	ix.Lock()
+	defer ix.Unlock()
+	if len(ix.entries) > idx/itemIndexInterval {
+		return ix.entries[idx/itemIndexInterval], nil
+	}
+	if ix.br == nil {
+		if ix.entries == nil {
+			ix.entries = append(ix.entries, itemIndexEntry{})
+		}
+		last := ix.entries[len(ix.entries)-1]
+		ix.br = compress.NewBitReaderAt(tf.block, last.bits)
+		ix.tickDec, ix.structDec = nil, nil
+		if last.state != nil {
+			var err error
+			ix.tickDec, ix.structDec, err = decompressFromState(tf.itemSection, tf.dataType, last.state)
+			if err != nil {
+				ix.br = nil
+				return itemIndexEntry{}, err
+			}
+		}
+	}
+	for len(ix.entries) <= idx/itemIndexInterval {
+		for i := 0; i < itemIndexInterval; i++ {
+			if _, err := tf.decodeItem(ix.br, &ix.tickDec, &ix.structDec); err != nil {
+				return itemIndexEntry{}, unexpectedEOF(err)
+			}
+		}
+		ix.entries = append(ix.entries, itemIndexEntry{
+			bits:  ix.br.State().Bits(),
+			state: marshalState(ix.tickDec.ToCompress(), ix.structDec.ToCompress()),
+		})
+	}
+	return ix.entries[idx/itemIndexInterval], nil
+}
+
+// checkpointEntry returns the checkpoint as an entry of the item index,
+// with the buffer it points into and the number of items before it, or
+// false if the file has no usable checkpoint.
+func (tf *TickFile) checkpointEntry() (itemIndexEntry, *compress.BBuffer, int, bool) {
+	tf.Lock()
+	defer tf.Unlock()
+	cs := tf.checkpointSection
+	if tf.block == nil || !tf.validCheckpoint(tf.dataBits()) || cs.DataBits < tf.dataBase*8 {
+		return itemIndexEntry{}, nil, 0, false
+	}
+	entry := itemIndexEntry{
+		bits:  cs.DataBits - tf.dataBase*8,
+		state: append([]byte(nil), cs.State...),
+	}
+	return entry, tf.block, int(cs.ItemCount), true
+}
+
+// ItemCount returns the number of items of the file
+func (tf *TickFile) ItemCount() int {
+	return int(tf.itemCount)
+}
+
+// writeItemIndex writes the entries of the item index after the data, then
+// the item index section locating them. The data must be flushed, the
+// entries missing are built from the data.
+func (tf *TickFile) writeItemIndex() error {
+	if tf.writer == nil {
+		return nil
+	}
+	count := int((tf.itemCount + itemIndexInterval - 1) / itemIndexInterval)
+	if !tf.itemIndex.has(int(tf.itemCount) - 1) {
+		// The data written before the file was opened is not indexed
+		if err := tf.loadDataLocked(); err != nil {
+			return err
+		}
+		if _, err := tf.indexEntry(int(tf.itemCount) - 1); err != nil {
+			return fmt.Errorf("error indexing items: %w", err)
+		}
+	}
+	var buf bytes.Buffer
+	tf.itemIndex.Lock()
+	// The first entry is the beginning of the data
+	for _, e := range tf.itemIndex.entries[1:count] {
+		if err := binary.Write(&buf, tf.order, e.bits); err != nil {
+			tf.itemIndex.Unlock()
+			return err
+		}
+		buf.Write(e.state)
+	}
+	tf.itemIndex.Unlock()
+	if _, err := tf.file.WriteAt(buf.Bytes(), tf.offset); err != nil {
+		return err
+	}
+	// The section is only rewritten once the entries are stored
+	if err := tf.file.Sync(); err != nil {
+		return fmt.Errorf("error syncing file: %w", err)
+	}
+
+	is := tf.itemIndexSection
+	is.DataEnd = tf.offset
+	is.ItemCount = tf.itemCount
+	is.LastTick = tf.lastTick
+	is.EntryCount = uint32(count - 1)
+	buf.Reset()
+	if err := is.Write(&buf, tf.order); err != nil {
+		return err
+	}
+	if _, err := tf.file.WriteAt(buf.Bytes(), tf.itemIndexOffset); err != nil {
+		return err
+	}
+	if _, err := tf.file.Seek(tf.offset, io.SeekStart); err != nil {
+		return err
+	}
+	return tf.file.Sync()
+}
+
+// readItemIndex loads the entries of the item index written after the data
+// read from the file, and returns the data without them. It returns false
+// if the file has no index or was written after it.
+func (tf *TickFile) readItemIndex(data []byte) ([]byte, bool) {
+	is := tf.itemIndexSection
+	if is == nil || is.DataEnd == 0 {
+		return data, false
+	}
+	entrySize := 8 + tf.itemSection.stateSize()
+	end := is.DataEnd - tf.header.ItemStart - tf.dataBase
+	count := int((is.ItemCount + itemIndexInterval - 1) / itemIndexInterval)
+	if end < 0 || end+int64(is.EntryCount)*int64(entrySize) != int64(len(data)) || int(is.EntryCount) != count-1 {
+		return data, false
+	}
+	entries := make([]itemIndexEntry, 1, count)
+	for p := data[end:]; len(p) > 0; p = p[entrySize:] {
+		entries = append(entries, itemIndexEntry{
+			bits:  int64(tf.order.Uint64(p)),
+			state: append([]byte(nil), p[8:entrySize]...),
+		})
+	}
+	tf.itemIndex.entries = entries
+	return data[:end], true
+}
+
+// dropItemIndex removes the entries of the item index from the end of the
+// file before the data is written again, and clears the item index section.
+func (tf *TickFile) dropItemIndex() error {
+	is := tf.itemIndexSection
+	if is == nil || is.DataEnd == 0 {
+		return nil
+	}
+	// Truncated first, the section doesn't match the size of the file anymore
+	if err := tf.file.Truncate(is.DataEnd); err != nil {
+		return fmt.Errorf("error truncating item index: %w", err)
+	}
+	*is = ItemIndexSection{}
+	var buf bytes.Buffer
+	if err := is.Write(&buf, tf.order); err != nil {
+		return err
+	}
+	if _, err := tf.file.WriteAt(buf.Bytes(), tf.itemIndexOffset); err != nil {
+		return err
+	}
+	if _, err := tf.file.Seek(tf.offset, io.SeekStart); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadItem returns the tick and a pointer to a copy of the item at idx.
+// With the stream layout, the items are decoded from the closest entry of
+// a sparse index built as the items are written or accessed, or loaded
+// from the file, or from the checkpoint for the items after it, with the
+// columnar layout from the start of the block of the item.
+func (tf *TickFile) ReadItem(idx int) (uint64, interface{}, error) {
+	if tf.itemSection == nil {
+		return 0, nil, fmt.Errorf("this file has no item section")
+	}
+	if idx < 0 || idx >= tf.ItemCount() {
+		return 0, nil, io.EOF
+	}
+	if tf.guard != nil {
+		if !tf.guard.acquire() {
+			return 0, nil, ErrClosed
+		}
+		defer tf.guard.RUnlock()
+	}
+	val := reflect.New(tf.dataType)
+	ptr := unsafe.Pointer(val.Pointer())
+	size := int(tf.dataType.Size())
+
+	var tick uint64
+	if tf.blocks != nil {
+		var err error
+		tick, err = tf.readBlockItem(idx, ptr)
+		if err != nil {
+			return 0, nil, err
+		}
+	} else {
+		// Index of the first item decoded from the entry
+		start := idx - idx%itemIndexInterval
+		entry, block, count, ok := tf.checkpointEntry()
+		var err error
+		if ok && idx >= count && (count > start || !tf.itemIndex.has(idx)) {
+			// The checkpoint is closer, or the index does not reach idx
+			start = count
+		} else {
+			if err := tf.loadData(); err != nil {
+				return 0, nil, err
+			}
+			block = tf.block
+			entry, err = tf.indexEntry(idx)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+		br := compress.NewBitReaderAt(block, entry.bits)
+		var tickDec *compress.TickDecompress
+		var structDec *StructDecompress
+		if entry.state != nil {
+			tickDec, structDec, err = decompressFromState(tf.itemSection, tf.dataType, entry.state)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+		for i := start; i <= idx; i++ {
+			tick, err = tf.decodeItem(br, &tickDec, &structDec)
+			if err != nil {
+				return 0, nil, unexpectedEOF(err)
+			}
+		}
+		copy(unsafeBytes(ptr, size), structDec.val[:size])
+	}
+	if swaps := tf.byteSwaps(); swaps != nil {
+		swapItems(ptr, 1, uintptr(size), swaps)
+	}
+	return tick, val.Interface(), nil
+}
+
+// readBlockItem reads the item at idx of a columnar file in ptr
+func (tf *TickFile) readBlockItem(idx int, ptr unsafe.Pointer) (uint64, error) {
+	blockIdx := 0
+	for {
+		b, count, last := tf.blocks.get(blockIdx)
+		if b == nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if idx < count {
+			break
+		}
+		if last {
+			return 0, io.ErrUnexpectedEOF
+		}
+		idx -= count
+		blockIdx += 1
+	}
+	fields := make([]int, len(tf.itemSection.Fields))
+	for i := range fields {
+		fields[i] = i
+	}
+	size := tf.dataType.Size()
+	cr := newColumnReader(tf.blocks, tf.itemSection, size, fields)
+	cr.openBlock(blockIdx)
+	for {
+		tick, deltas, err := cr.Next(context.Background())
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		if idx < deltas.Len {
+			item := unsafe.Pointer(uintptr(deltas.Pointer) + uintptr(idx)*size)
+			copy(unsafeBytes(ptr, int(size)), unsafeBytes(item, int(size)))
+			return tick, nil
+		}
+		idx -= deltas.Len
+	}
+}
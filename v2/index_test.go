@@ -0,0 +1,293 @@
+package gotickfile
+
+import (
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func checkReadItem(t *testing.T, tf *TickFile, ticks []uint64, goldenDeltas []Data) {
+	if tf.ItemCount() != len(ticks) {
+		t.Fatalf("got different item count: %d %d", tf.ItemCount(), len(ticks))
+	}
+	// Random items, and the items around the index entries
+	var indices []int
+	for i := 0; i < 200; i++ {
+		indices = append(indices, rand.Intn(len(ticks)))
+	}
+	for i := 0; i < len(ticks); i += itemIndexInterval {
+		indices = append(indices, i, i+1)
+		if i > 0 {
+			indices = append(indices, i-1)
+		}
+	}
+	indices = append(indices, len(ticks)-1)
+	for _, i := range indices {
+		tick, val, err := tf.ReadItem(i)
+		if err != nil {
+			t.Fatalf("error reading item %d: %v", i, err)
+		}
+		if tick != ticks[i] || *val.(*Data) != goldenDeltas[i] {
+			t.Fatalf("got different item at %d: %d %v, %d %v", i, tick, *val.(*Data), ticks[i], goldenDeltas[i])
+		}
+	}
+	if _, _, err := tf.ReadItem(len(ticks)); err != io.EOF {
+		t.Fatalf("was expecting EOF, got %v", err)
+	}
+	if _, _, err := tf.ReadItem(-1); err != io.EOF {
+		t.Fatalf("was expecting EOF, got %v", err)
+	}
+}
+
+func TestReadItem(t *testing.T) {
+	for _, configs := range [][]TickFileConfig{nil, {WithColumnarLayout(100)}} {
+		file, err := fs.Create("index.tick")
+		if err != nil {
+			t.Fatalf("error creating file")
+		}
+		tf, err := Create(file, append([]TickFileConfig{WithDataType(reflect.TypeOf(Data{}))}, configs...)...)
+		if err != nil {
+			t.Fatalf("error creating tickfile: %v", err)
+		}
+
+		var ticks []uint64
+		var goldenDeltas []Data
+		write := func(n int) {
+			for i := 0; i < n; i++ {
+				tick := uint64(len(ticks) / 3)
+				delta := Data{Time: uint64(len(ticks)), Price: uint32(rand.Int()), Prib: uint64(rand.Intn(10))}
+				if err := tf.Write(tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+					t.Fatalf("error writing: %v", err)
+				}
+				ticks = append(ticks, tick)
+				goldenDeltas = append(goldenDeltas, delta)
+			}
+		}
+		write(3*itemIndexInterval + 10)
+		// Items can be read while writing
+		checkReadItem(t, tf, ticks, goldenDeltas)
+		write(500)
+		checkReadItem(t, tf, ticks, goldenDeltas)
+		if err := tf.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening tickfile: %v", err)
+		}
+		checkReadItem(t, tf, ticks, goldenDeltas)
+
+		tf, err = OpenWrite(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening tickfile: %v", err)
+		}
+		write(10)
+		if err := tf.Close(); err != nil {
+			t.Fatal(err)
+		}
+		tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening tickfile: %v", err)
+		}
+		checkReadItem(t, tf, ticks, goldenDeltas)
+	}
+}
+
+func TestReadItemCold(t *testing.T) {
+	mfile, err := fs.Create("index.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	tf, err := Create(mfile, WithDataType(reflect.TypeOf(Data{})), WithCheckpoint())
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	var ticks []uint64
+	var goldenDeltas []Data
+	write := func(tf *TickFile, n int) {
+		for i := 0; i < n; i++ {
+			tick := uint64(len(ticks) / 3)
+			delta := Data{Time: uint64(len(ticks)), Price: uint32(rand.Int()), Prib: uint64(rand.Intn(10))}
+			if err := tf.Write(tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+				t.Fatalf("error writing: %v", err)
+			}
+			ticks = append(ticks, tick)
+			goldenDeltas = append(goldenDeltas, delta)
+		}
+	}
+	write(tf, 50000)
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Items after the checkpoint
+	tf, err = OpenWrite(mfile, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	write(tf, 500)
+	if err := tf.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := mfile.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The last items are decoded from the checkpoint, only the data after
+	// it is read
+	file := &readCountFile{File: mfile}
+	tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	for _, i := range []int{len(ticks) - 1, 50000, 50200} {
+		tick, val, err := tf.ReadItem(i)
+		if err != nil {
+			t.Fatalf("error reading item %d: %v", i, err)
+		}
+		if tick != ticks[i] || *val.(*Data) != goldenDeltas[i] {
+			t.Fatalf("got different item at %d: %d %v, %d %v", i, tick, *val.(*Data), ticks[i], goldenDeltas[i])
+		}
+	}
+	if file.read > int(tf.header.ItemStart)+checkpointInterval/8 || fi.Size() < checkpointInterval {
+		t.Fatalf("read %d bytes of a file of %d bytes", file.read, fi.Size())
+	}
+	if len(tf.itemIndex.entries) != 0 {
+		t.Fatalf("was expecting the item index not to be built")
+	}
+	checkReadItem(t, tf, ticks, goldenDeltas)
+}
+
+func TestReadItemIndexed(t *testing.T) {
+	for _, configs := range [][]TickFileConfig{nil, {WithCheckpoint()}} {
+		testReadItemIndexed(t, configs)
+	}
+}
+
+func testReadItemIndexed(t *testing.T, configs []TickFileConfig) {
+	file, err := fs.Create("index.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	tf, err := Create(file, append([]TickFileConfig{WithDataType(reflect.TypeOf(Data{})), WithItemIndex()}, configs...)...)
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	var ticks []uint64
+	var goldenDeltas []Data
+	write := func(tf *TickFile, n int) {
+		for i := 0; i < n; i++ {
+			tick := uint64(len(ticks) / 3)
+			delta := Data{Time: uint64(len(ticks)), Price: uint32(rand.Int()), Prib: uint64(rand.Intn(10))}
+			if err := tf.Write(tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+				t.Fatalf("error writing: %v", err)
+			}
+			ticks = append(ticks, tick)
+			goldenDeltas = append(goldenDeltas, delta)
+		}
+	}
+	// checkIndexed checks that the item index is loaded from the file, and
+	// that ReadItem doesn't decode the data to extend it
+	checkIndexed := func() {
+		tf, err := OpenRead(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening tickfile: %v", err)
+		}
+		if n := (len(ticks) + itemIndexInterval - 1) / itemIndexInterval; len(tf.itemIndex.entries) != n {
+			t.Fatalf("was expecting %d entries, got %d", n, len(tf.itemIndex.entries))
+		}
+		checkReadItem(t, tf, ticks, goldenDeltas)
+		if tf.itemIndex.br != nil {
+			t.Fatalf("was expecting the items not to be decoded from the beginning")
+		}
+		reader, err := tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for {
+			_, deltas, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			n += deltas.Len
+		}
+		if n != len(ticks) {
+			t.Fatalf("got %d items, was expecting %d", n, len(ticks))
+		}
+		// The stream reader stops before the index
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		sr, err := NewStreamReader(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening stream: %v", err)
+		}
+		n = 0
+		for {
+			_, deltas, err := sr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			n += deltas.Len
+		}
+		if n != len(ticks) {
+			t.Fatalf("got %d items from the stream, was expecting %d", n, len(ticks))
+		}
+	}
+
+	write(tf, 5000)
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexed()
+
+	// A file written after its index is read without it
+	tf, err = OpenWrite(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	write(tf, 3000)
+	if err := tf.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	rtf, err := OpenRead(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	if len(rtf.itemIndex.entries) != 0 {
+		t.Fatalf("was expecting the item index to be dropped")
+	}
+	checkReadItem(t, rtf, ticks, goldenDeltas)
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexed()
+
+	// The index of a file opened without it is built when closing
+	tf, err = OpenWrite(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	if err := tf.dropItemIndex(); err != nil {
+		t.Fatal(err)
+	}
+	tf, err = OpenWrite(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	write(tf, 100)
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkIndexed()
+}
@@ -0,0 +1,154 @@
+package gotickfile
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// tickFileIO is the part of a kafero.File used by a TickFile
+type tickFileIO interface {
+	io.ReadWriteSeeker
+	io.WriterAt
+	Name() string
+	Sync() error
+	Truncate(size int64) error
+}
+
+// memFile is a file held in memory
+type memFile struct {
+	data []byte
+	off  int64
+}
+
+func (m *memFile) Name() string {
+	return ""
+}
+
+func (m *memFile) Sync() error {
+	return nil
+}
+
+func (m *memFile) Read(p []byte) (int, error) {
+	if m.off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[m.off:])
+	m.off += int64(n)
+	return n, nil
+}
+
+func (m *memFile) Write(p []byte) (int, error) {
+	n, err := m.WriteAt(p, m.off)
+	m.off += int64(n)
+	return n, err
+}
+
+func (m *memFile) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	if end := off + int64(len(p)); end > int64(len(m.data)) {
+		m.grow(end)
+	}
+	return copy(m.data[off:], p), nil
+}
+
+func (m *memFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += m.off
+	case io.SeekEnd:
+		offset += int64(len(m.data))
+	default:
+		return 0, fmt.Errorf("invalid whence")
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	m.off = offset
+	return offset, nil
+}
+
+func (m *memFile) Truncate(size int64) error {
+	if size < 0 {
+		return fmt.Errorf("negative size")
+	}
+	if size > int64(len(m.data)) {
+		m.grow(size)
+	}
+	m.data = m.data[:size]
+	return nil
+}
+
+// grow extends the data to size with zeros
+func (m *memFile) grow(size int64) {
+	if size <= int64(cap(m.data)) {
+		l := len(m.data)
+		m.data = m.data[:size]
+		for i := l; i < len(m.data); i++ {
+			m.data[i] = 0
+		}
+		return
+	}
+	c := 2 * int64(cap(m.data))
+	if c < size {
+		c = size
+	}
+	data := make([]byte, size, c)
+	copy(data, m.data)
+	m.data = data
+}
+
+// CreateInMemory creates a file held in memory, its encoded content is
+// returned by Bytes and WriteTo.
+func CreateInMemory(configs ...TickFileConfig) (*TickFile, error) {
+	return create(&memFile{}, configs...)
+}
+
+// FromBytes opens the encoded content of a file for reading, as returned by
+// Bytes. The data is not modified.
+func FromBytes(data []byte, dataType reflect.Type, configs ...TickFileConfig) (*TickFile, error) {
+	return openRead(context.Background(), &memFile{data: data}, dataType, configs...)
+}
+
+// WriteTo flushes the file and writes its encoded content to w. The items
+// held by the reorder buffer are not written.
+func (tf *TickFile) WriteTo(w io.Writer) (int64, error) {
+	tf.Lock()
+	defer tf.Unlock()
+	if tf.write {
+		if err := tf.flush(false); err != nil {
+			return 0, err
+		}
+	}
+	if m, ok := tf.file.(*memFile); ok {
+		n, err := w.Write(m.data)
+		return int64(n), err
+	}
+	if _, err := tf.file.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("error seeking to beginning of file: %w", err)
+	}
+	n, err := io.Copy(w, tf.file)
+	if err != nil {
+		return n, err
+	}
+	if tf.write {
+		if _, err := tf.file.Seek(tf.offset, io.SeekStart); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Bytes flushes the file and returns a copy of its encoded content
+func (tf *TickFile) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := tf.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
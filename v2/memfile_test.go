@@ -0,0 +1,118 @@
+package gotickfile
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestInMemory(t *testing.T) {
+	for _, configs := range [][]TickFileConfig{nil, {WithColumnarLayout(100)}} {
+		tf, err := CreateInMemory(append([]TickFileConfig{
+			WithDataType(reflect.TypeOf(Data{})),
+			WithTags(map[string]string{"tag": "value"}),
+		}, configs...)...)
+		if err != nil {
+			t.Fatalf("error creating tickfile: %v", err)
+		}
+		if tf.GetFile() != nil {
+			t.Fatalf("was expecting no file")
+		}
+
+		var ticks []uint64
+		var goldenDeltas []Data
+		for i := 0; i < 1000; i++ {
+			tick := uint64(i / 3)
+			delta := Data{Time: uint64(i), Price: uint32(rand.Int()), Prib: uint64(rand.Intn(10))}
+			if err := tf.Write(tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+				t.Fatalf("error writing: %v", err)
+			}
+			ticks = append(ticks, tick)
+			goldenDeltas = append(goldenDeltas, delta)
+			// The content can be taken while writing
+			if i == 500 {
+				data, err := tf.Bytes()
+				if err != nil {
+					t.Fatal(err)
+				}
+				rtf, err := FromBytes(data, reflect.TypeOf(Data{}))
+				if err != nil {
+					t.Fatalf("error opening tickfile: %v", err)
+				}
+				checkReadItem(t, rtf, ticks, goldenDeltas)
+			}
+		}
+		if err := tf.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := tf.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		n, err := tf.WriteTo(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(len(data)) || !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("got different content from WriteTo and Bytes")
+		}
+
+		// The content is the same as the one of a file
+		file, err := fs.Create("memory.tick")
+		if err != nil {
+			t.Fatalf("error creating file")
+		}
+		if _, err := file.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		for _, open := range []func() (*TickFile, error){
+			func() (*TickFile, error) { return FromBytes(data, reflect.TypeOf(Data{})) },
+			func() (*TickFile, error) { return OpenRead(file, reflect.TypeOf(Data{})) },
+		} {
+			rtf, err := open()
+			if err != nil {
+				t.Fatalf("error opening tickfile: %v", err)
+			}
+			if rtf.GetTags()["tag"] != "value" {
+				t.Fatalf("got different tags: %v", rtf.GetTags())
+			}
+			checkReadItem(t, rtf, ticks, goldenDeltas)
+			reader, err := rtf.GetTickReader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			i := 0
+			for {
+				tick, deltas, err := reader.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				for j := 0; j < deltas.Len; j++ {
+					d := *(*Data)(unsafe.Pointer(uintptr(deltas.Pointer) + uintptr(j)*unsafe.Sizeof(Data{})))
+					if tick != ticks[i] || d != goldenDeltas[i] {
+						t.Fatalf("got different item at %d", i)
+					}
+					i++
+				}
+			}
+			if i != len(ticks) {
+				t.Fatalf("got %d items, was expecting %d", i, len(ticks))
+			}
+			// The content of a file read from bytes is the same
+			if content, err := rtf.Bytes(); err != nil || !bytes.Equal(content, data) {
+				t.Fatalf("got different content: %v", err)
+			}
+			if err := rtf.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package gotickfile
+
+import (
+	"container/heap"
+	"context"
+	"io"
+)
+
+type mergeItem struct {
+	source int
+	tick   uint64
+	deltas TickDeltas
+}
+
+type mergeHeap []mergeItem
+
+func (h mergeHeap) Len() int {
+	return len(h)
+}
+
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].tick == h[j].tick {
+		return h[i].source < h[j].source
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h mergeHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *mergeHeap) Push(x interface{}) {
+	*h = append(*h, x.(mergeItem))
+}
+
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// MergedReader returns the tick groups of many readers in tick order.
+type MergedReader struct {
+	readers []*CTickReader
+	heap    mergeHeap
+	// Number of readers advanced by the first call, a reader that failed
+	// is advanced again by the next call
+	primed int
+	// Source of the last returned group, advanced on the next call as
+	// the returned deltas point to its buffer
+	last int
+}
+
+// MergeReaders merges the readers in tick order. The readers can have
+// different delta types.
+func MergeReaders(readers ...*CTickReader) *MergedReader {
+	return &MergedReader{
+		readers: readers,
+		last:    -1,
+	}
+}
+
+func (m *MergedReader) advance(ctx context.Context, source int) error {
+	tick, deltas, err := m.readers[source].NextContext(ctx)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	heap.Push(&m.heap, mergeItem{
+		source: source,
+		tick:   tick,
+		deltas: deltas,
+	})
+	return nil
+}
+
+// Next returns the next tick group and the index of the reader it comes
+// from. Groups with the same tick are returned in reader order. The
+// deltas are valid until the next call.
+func (m *MergedReader) Next() (int, uint64, TickDeltas, error) {
+	return m.NextContext(context.Background())
+}
+
+// NextContext is like Next, but returns the context error if the context
+// is done while reading.
+func (m *MergedReader) NextContext(ctx context.Context) (int, uint64, TickDeltas, error) {
+	for m.primed < len(m.readers) {
+		if err := m.advance(ctx, m.primed); err != nil {
+			return m.primed, 0, TickDeltas{}, err
+		}
+		m.primed += 1
+	}
+	if m.last >= 0 {
+		if err := m.advance(ctx, m.last); err != nil {
+			return m.last, 0, TickDeltas{}, err
+		}
+		m.last = -1
+	}
+	if len(m.heap) == 0 {
+		return -1, 0, TickDeltas{}, io.EOF
+	}
+	item := heap.Pop(&m.heap).(mergeItem)
+	m.last = item.source
+	return item.source, item.tick, item.deltas, nil
+}
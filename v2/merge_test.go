@@ -0,0 +1,149 @@
+package gotickfile
+
+import (
+	"fmt"
+	"github.com/melaurent/gotickfile/v2/compress"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestMergeReaders(t *testing.T) {
+	type group struct {
+		source int
+		tick   uint64
+		price  uint32
+	}
+	var golden []group
+	var readers []*CTickReader
+	for k := 0; k < 3; k++ {
+		name := fmt.Sprintf("merge%d.tick", k)
+		file, err := fs.Create(name)
+		if err != nil {
+			t.Fatalf("error creating file")
+		}
+		tf, err := Create(file, WithDataType(reflect.TypeOf(Data{})))
+		if err != nil {
+			t.Fatalf("error creating tickfile: %v", err)
+		}
+		var tick uint64 = 0
+		for i := 0; i < 200; i++ {
+			tick += uint64(rand.Intn(5))
+			delta := Data{Price: uint32(k*1000 + i)}
+			if err := tf.Write(tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+				t.Fatalf("error writing: %v", err)
+			}
+			golden = append(golden, group{source: k, tick: tick, price: delta.Price})
+		}
+		reader, err := tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		readers = append(readers, reader)
+	}
+
+	m := MergeReaders(readers...)
+	var got []group
+	source, tick, deltas, err := m.Next()
+	for err == nil {
+		for i := 0; i < deltas.Len; i++ {
+			ptr := unsafe.Pointer(uintptr(deltas.Pointer) + uintptr(i)*unsafe.Sizeof(Data{}))
+			got = append(got, group{source: source, tick: tick, price: (*Data)(ptr).Price})
+		}
+		source, tick, deltas, err = m.Next()
+	}
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+	if len(got) != len(golden) {
+		t.Fatalf("got %d items, was expecting %d", len(got), len(golden))
+	}
+	for i := 1; i < len(got); i++ {
+		a, b := got[i-1], got[i]
+		if a.tick > b.tick || (a.tick == b.tick && a.source > b.source) {
+			t.Fatalf("items not in order: %v %v", a, b)
+		}
+	}
+	// Items of a source keep their order
+	next := make([]int, 3)
+	for _, g := range got {
+		if g.price != uint32(g.source*1000+next[g.source]) {
+			t.Fatalf("got unexpected item: %v", g)
+		}
+		next[g.source] += 1
+	}
+}
+
+func TestMergeReadersRetry(t *testing.T) {
+	var readers []*CTickReader
+	for k := 0; k < 2; k++ {
+		tf, err := CreateInMemory(WithDataType(reflect.TypeOf(Data{})))
+		if err != nil {
+			t.Fatalf("error creating tickfile: %v", err)
+		}
+		for i := 0; i < 100; i++ {
+			delta := Data{Price: uint32(k*1000 + i)}
+			if err := tf.Write(uint64(i), TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+				t.Fatalf("error writing: %v", err)
+			}
+		}
+		reader, err := tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		readers = append(readers, reader)
+	}
+
+	// The last source is cut in its first item
+	info, err := TypeToItemSection(reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := compress.NewBBuffer(nil, 0)
+	delta := Data{Price: 2000}
+	w := NewCTickWriter(full, info, 0, unsafe.Pointer(&delta))
+	for i := 1; i < 100; i++ {
+		delta = Data{Price: uint32(2000 + i)}
+		w.Write(full, uint64(i), unsafe.Pointer(&delta))
+	}
+	data := full.Bytes()
+	buf := compress.NewBBuffer(append([]byte{}, data[:3]...), 0)
+	reader, err := NewCTickReader(info, reflect.TypeOf(Data{}), compress.NewBitReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := reader.State()
+	readers = append(readers, reader)
+
+	m := MergeReaders(readers...)
+	if source, _, _, err := m.Next(); err == nil || source != 2 {
+		t.Fatalf("was expecting an error from source 2, got %d %v", source, err)
+	}
+	// Complete the source, the next call only advances it
+	buf.WriteBytes(data[3 : len(data)-1])
+	buf.WriteBits(uint64(data[len(data)-1]>>full.Count()), 8-int(full.Count()))
+	if err := reader.Reset(start); err != nil {
+		t.Fatal(err)
+	}
+
+	next := make([]int, 3)
+	count := 0
+	source, tick, deltas, err := m.Next()
+	for err == nil {
+		price := (*Data)(deltas.Pointer).Price
+		if deltas.Len != 1 || tick != uint64(next[source]) || price != uint32(source*1000+next[source]) {
+			t.Fatalf("got unexpected group from %d: %d %d", source, tick, price)
+		}
+		next[source] += 1
+		count += 1
+		source, tick, deltas, err = m.Next()
+	}
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+	if count != 300 {
+		t.Fatalf("got %d groups, was expecting 300", count)
+	}
+}
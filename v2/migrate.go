@@ -0,0 +1,199 @@
+package gotickfile
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/melaurent/kafero"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// TypeResolver returns the data type of the file at path, or nil to skip
+// the file.
+type TypeResolver func(path string) (reflect.Type, error)
+
+// MigrateError is returned by MigrateTree with the error of each file that
+// could not be migrated.
+type MigrateError struct {
+	Errors map[string]error
+}
+
+func (e *MigrateError) Error() string {
+	paths := make([]string, 0, len(e.Errors))
+	for p := range e.Errors {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return fmt.Sprintf("error migrating %d files, %s: %v", len(paths), paths[0], e.Errors[paths[0]])
+}
+
+// MigrateTree converts the v1 files of srcFs to v2 files at the same path
+// in dstFs, converting workers files in parallel. Each converted file is
+// read again and compared to the original, and gets the modification time
+// of the original. Files that are not v1 tickfiles are skipped. The whole
+// tree of srcFs is walked, kafero.NewBasePathFs restricts it to a
+// directory.
+func MigrateTree(srcFs, dstFs kafero.Fs, resolve TypeResolver, workers int) error {
+	if workers <= 0 {
+		return fmt.Errorf("invalid number of workers: %d", workers)
+	}
+	var paths []string
+	err := kafero.Walk(srcFs, "/", func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error walking tree: %w", err)
+	}
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(map[string]error)
+	pathChan := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range pathChan {
+				if err := migrateFile(srcFs, dstFs, p, resolve); err != nil {
+					lock.Lock()
+					errs[p] = err
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+	for _, p := range paths {
+		pathChan <- p
+	}
+	close(pathChan)
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &MigrateError{Errors: errs}
+	}
+	return nil
+}
+
+func migrateFile(srcFs, dstFs kafero.Fs, p string, resolve TypeResolver) error {
+	src, err := srcFs.Open(p)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < 8 {
+		return nil
+	}
+	v1, err := isV1(src)
+	if err != nil || !v1 {
+		return err
+	}
+	typ, err := resolve(p)
+	if err != nil || typ == nil {
+		return err
+	}
+
+	if err := dstFs.MkdirAll(path.Dir(p), 0755); err != nil {
+		return err
+	}
+	dst, err := dstFs.Create(p)
+	if err != nil {
+		return err
+	}
+	err = V1ToV2(dst, src, typ)
+	if err == nil {
+		err = verifyMigration(dst, src, typ)
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = dstFs.Chtimes(p, info.ModTime(), info.ModTime())
+	}
+	if err != nil {
+		// Don't leave a partial file behind
+		_ = dstFs.Remove(p)
+		return err
+	}
+	return nil
+}
+
+// verifyMigration checks that the dst file has the same content as the
+// src file
+func verifyMigration(dst, src kafero.File, typ reflect.Type) error {
+	r1, err := Open(src, typ)
+	if err != nil {
+		return err
+	}
+	defer r1.Close()
+	r2, err := Open(dst, typ)
+	if err != nil {
+		return err
+	}
+	defer r2.Close()
+
+	if !reflect.DeepEqual(r1.GetTags(), r2.GetTags()) {
+		return fmt.Errorf("different tags")
+	}
+	if !reflect.DeepEqual(r1.GetNameValues(), r2.GetNameValues()) {
+		return fmt.Errorf("different name values")
+	}
+	if !reflect.DeepEqual(r1.GetContentDescription(), r2.GetContentDescription()) {
+		return fmt.Errorf("different content description")
+	}
+
+	size := int(typ.Size())
+	ranges := fieldRanges(typ)
+	for {
+		tick1, deltas1, err1 := r1.Next()
+		tick2, deltas2, err2 := r2.Next()
+		if err1 == io.EOF && err2 == io.EOF {
+			return nil
+		}
+		if err1 != nil {
+			return fmt.Errorf("error reading tickfile v1: %w", err1)
+		}
+		if err2 != nil {
+			return fmt.Errorf("error reading tickfile v2: %w", err2)
+		}
+		if tick1 != tick2 || deltas1.Len != deltas2.Len {
+			return fmt.Errorf("different tick group: %d %d, %d %d", tick1, deltas1.Len, tick2, deltas2.Len)
+		}
+		b1 := unsafeBytes(deltas1.Pointer, deltas1.Len*size)
+		b2 := unsafeBytes(deltas2.Pointer, deltas2.Len*size)
+		for i := 0; i < len(b1); i += size {
+			for _, r := range ranges {
+				if !bytes.Equal(b1[i+r[0]:i+r[1]], b2[i+r[0]:i+r[1]]) {
+					return fmt.Errorf("different deltas at tick %d", tick1)
+				}
+			}
+		}
+	}
+}
+
+// fieldRanges returns the byte ranges of the fields of the type, the
+// padding between them is not compared
+func fieldRanges(typ reflect.Type) [][2]int {
+	if typ.Kind() != reflect.Struct {
+		return [][2]int{{0, int(typ.Size())}}
+	}
+	var ranges [][2]int
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		ranges = append(ranges, [2]int{int(f.Offset), int(f.Offset + f.Type.Size())})
+	}
+	return ranges
+}
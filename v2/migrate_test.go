@@ -0,0 +1,123 @@
+package gotickfile
+
+import (
+	"errors"
+	gotickfilev1 "github.com/melaurent/gotickfile"
+	"github.com/melaurent/kafero"
+	"math/rand"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createV1File(t *testing.T, fs kafero.Fs, path string, n int) ([]uint64, []Data) {
+	if err := fs.MkdirAll("/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := fs.Create(path)
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	tf, err := gotickfilev1.Create(
+		file,
+		gotickfilev1.WithDataType(reflect.TypeOf(Data{})),
+		gotickfilev1.WithTags(map[string]string{"path": path}),
+		gotickfilev1.WithNameValues(map[string]interface{}{"decimals": int32(2)}))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	var ticks []uint64
+	var goldenDeltas []Data
+	for i := 0; i < n; i++ {
+		tick := uint64(i / 4)
+		deltas := []Data{{Time: uint64(i), Price: uint32(rand.Int()), Volume: uint64(rand.Int())}}
+		if err := tf.Write(tick, &deltas); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+		ticks = append(ticks, tick)
+		goldenDeltas = append(goldenDeltas, deltas[0])
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return ticks, goldenDeltas
+}
+
+func TestMigrateTree(t *testing.T) {
+	srcFs := kafero.NewMemMapFs()
+	dstFs := kafero.NewMemMapFs()
+	ticks1, deltas1 := createV1File(t, srcFs, "/a/x.tick", 1000)
+	ticks2, deltas2 := createV1File(t, srcFs, "/a/b/y.tick", 10)
+	createV1File(t, srcFs, "/a/b/bad.tick", 10)
+	mtime := time.Date(2015, 3, 4, 5, 6, 7, 0, time.UTC)
+	if err := srcFs.Chtimes("/a/x.tick", mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	// v2 files and other files are skipped
+	file, err := srcFs.Create("/a/v2.tick")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(file, WithDataType(reflect.TypeOf(Data{}))); err != nil {
+		t.Fatal(err)
+	}
+	if err := kafero.WriteFile(srcFs, "/notes.txt", []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resolve := func(path string) (reflect.Type, error) {
+		if strings.HasSuffix(path, "bad.tick") {
+			return nil, errors.New("unknown type")
+		}
+		return reflect.TypeOf(Data{}), nil
+	}
+	err = MigrateTree(srcFs, dstFs, resolve, 4)
+	merr, ok := err.(*MigrateError)
+	if !ok {
+		t.Fatalf("was expecting a migrate error, got %v", err)
+	}
+	if len(merr.Errors) != 1 || merr.Errors["/a/b/bad.tick"] == nil {
+		t.Fatalf("got different errors: %v", merr.Errors)
+	}
+
+	for _, path := range []string{"/a/v2.tick", "/notes.txt", "/a/b/bad.tick"} {
+		if _, err := dstFs.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("was expecting %s to be skipped", path)
+		}
+	}
+	info, err := dstFs.Stat("/a/x.tick")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Fatalf("got different modification time: %s", info.ModTime())
+	}
+	for path, golden := range map[string][]Data{"/a/x.tick": deltas1, "/a/b/y.tick": deltas2} {
+		ticks := ticks1
+		if path == "/a/b/y.tick" {
+			ticks = ticks2
+		}
+		file, err := dstFs.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tf, err := OpenRead(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening %s: %v", path, err)
+		}
+		if tf.GetTags()["path"] != path {
+			t.Fatalf("got different tags: %v", tf.GetTags())
+		}
+		reader, err := tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReader(t, reader, ticks, golden, func(d Data) Data { return d })
+	}
+}
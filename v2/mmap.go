@@ -0,0 +1,72 @@
+package gotickfile
+
+import (
+	"context"
+	"fmt"
+	"github.com/melaurent/kafero"
+	"sync"
+)
+
+// mapGuard is shared by a mapped file and its readers. The readers hold
+// the read lock while they decode, the mapping is released under the
+// write lock, after which the readers return ErrClosed.
+type mapGuard struct {
+	sync.RWMutex
+	closed bool
+}
+
+// acquire read locks the guard, returning false if the mapping was
+// released
+func (g *mapGuard) acquire() bool {
+	g.RLock()
+	if g.closed {
+		g.RUnlock()
+		return false
+	}
+	return true
+}
+
+// readData returns the data of the file, after the header. If the file can
+// be mapped in memory, the data is decoded directly from the mapping and is
+// only loaded when touched, otherwise the file is read.
+func (tf *TickFile) readData(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if file, ok := tf.file.(kafero.File); ok && file.CanMmap() {
+		fi, err := file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("error getting file info: %w", err)
+		}
+		size := fi.Size()
+		if size > tf.header.ItemStart && size == int64(int(size)) {
+			data, err := mmapFile(file, int(size))
+			if err == nil {
+				tf.mmap = data
+				tf.guard = &mapGuard{}
+				return data[tf.header.ItemStart:], nil
+			}
+			// Fall back to reading the file
+		}
+	}
+	return tf.readTail(ctx)
+}
+
+// munmap releases the mapping of the file once the readers are done
+// decoding, the readers return ErrClosed after.
+func (tf *TickFile) munmap() error {
+	if tf.mmap == nil {
+		return nil
+	}
+	tf.guard.Lock()
+	defer tf.guard.Unlock()
+	tf.guard.closed = true
+	tf.mmap = nil
+	tf.block = nil
+	tf.blocks = nil
+	// Only a kafero.File can be mapped
+	if err := tf.file.(kafero.File).Munmap(); err != nil {
+		return fmt.Errorf("error unmapping file: %w", err)
+	}
+	return nil
+}
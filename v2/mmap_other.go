@@ -0,0 +1,13 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package gotickfile
+
+import (
+	"fmt"
+	"github.com/melaurent/kafero"
+)
+
+func mmapFile(file kafero.File, size int) ([]byte, error) {
+	return nil, fmt.Errorf("mmap not supported")
+}
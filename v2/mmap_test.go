@@ -0,0 +1,232 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package gotickfile
+
+import (
+	"fmt"
+	"github.com/melaurent/kafero"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// mmapTestFile maps the file with syscall.Mmap
+type mmapTestFile struct {
+	kafero.File
+	mmap []byte
+}
+
+func (f *mmapTestFile) CanMmap() bool {
+	return true
+}
+
+func (f *mmapTestFile) Mmap(offset int64, length int, prot int, flags int) ([]byte, error) {
+	file, err := os.Open(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	b, err := syscall.Mmap(int(file.Fd()), offset, length, prot, flags)
+	if err != nil {
+		return nil, err
+	}
+	f.mmap = b
+	return b, nil
+}
+
+func (f *mmapTestFile) Munmap() error {
+	if f.mmap == nil {
+		return fmt.Errorf("file not mmapped")
+	}
+	if err := syscall.Munmap(f.mmap); err != nil {
+		return err
+	}
+	f.mmap = nil
+	return nil
+}
+
+func TestMmap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotickfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	osFs := kafero.NewOsFs()
+
+	layouts := map[string][]TickFileConfig{
+		"stream":   nil,
+		"columnar": {WithColumnarLayout(1000)},
+	}
+	for name, configs := range layouts {
+		fileName := path.Join(dir, name+".tick")
+		file, err := osFs.Create(fileName)
+		if err != nil {
+			t.Fatalf("error creating file: %v", err)
+		}
+		configs = append([]TickFileConfig{WithDataType(reflect.TypeOf(Data{}))}, configs...)
+		tf, err := Create(file, configs...)
+		if err != nil {
+			t.Fatalf("error creating tickfile: %v", err)
+		}
+		for i := 0; i < 5000; i++ {
+			delta := Data{Time: uint64(i), Price: uint32(i * 3)}
+			if err := tf.Write(uint64(i), TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+				t.Fatalf("error writing: %v", err)
+			}
+		}
+		if err := tf.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := file.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		rfile, err := osFs.Open(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mfile := &mmapTestFile{File: rfile}
+		tf, err = OpenRead(mfile, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening tickfile: %v", err)
+		}
+		if mfile.mmap == nil {
+			t.Fatalf("%s: file not mapped", name)
+		}
+		reader, err := tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 5000; i++ {
+			tick, deltas, err := reader.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := *(*Data)(deltas.Pointer)
+			if tick != uint64(i) || d.Time != uint64(i) || d.Price != uint32(i*3) {
+				t.Fatalf("%s: got a different read than expected at %d", name, i)
+			}
+		}
+		if _, _, err := reader.Next(); err != io.EOF {
+			t.Fatalf("was expecting EOF, got %v", err)
+		}
+		// A reader left in the middle of the file
+		open, err := tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2500; i++ {
+			if _, _, err := open.Next(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		state := open.State()
+		// And a reader reading while the file is closed
+		concurrent, err := tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error)
+		go func() {
+			var err error
+			for err == nil {
+				_, _, err = concurrent.Next()
+			}
+			done <- err
+		}()
+		if err := tf.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-done; err != ErrClosed && err != io.EOF {
+			t.Fatalf("%s: was expecting ErrClosed or EOF, got %v", name, err)
+		}
+		// The readers do not read the unmapped file
+		if err := open.Reset(state); err != ErrClosed {
+			t.Fatalf("%s: was expecting ErrClosed, got %v", name, err)
+		}
+		if _, _, err := open.Next(); err != ErrClosed {
+			t.Fatalf("%s: was expecting ErrClosed, got %v", name, err)
+		}
+		if _, _, err := tf.ReadItem(0); err != ErrClosed {
+			t.Fatalf("%s: was expecting ErrClosed, got %v", name, err)
+		}
+		if _, err := tf.GetTickReader(); err != ErrClosed {
+			t.Fatalf("%s: was expecting ErrClosed, got %v", name, err)
+		}
+		if mfile.mmap != nil {
+			t.Fatalf("%s: file not unmapped on close", name)
+		}
+		if err := rfile.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// mmapTestFs opens the files as mmapTestFile
+type mmapTestFs struct {
+	kafero.Fs
+	files []*mmapTestFile
+}
+
+func (fs *mmapTestFs) Open(name string) (kafero.File, error) {
+	file, err := fs.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	mfile := &mmapTestFile{File: file}
+	fs.files = append(fs.files, mfile)
+	return mfile, nil
+}
+
+func TestStoreReaderUnmap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotickfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mfs := &mmapTestFs{Fs: kafero.NewOsFs()}
+	store := NewStore(mfs, dir, reflect.TypeOf(Data{}), WithPartition(time.Hour))
+	start := uint64(time.Date(2021, 3, 1, 22, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond))
+	for i := 0; i < 300; i++ {
+		tick := start + uint64(i)*uint64(time.Minute/time.Millisecond)
+		delta := Data{Time: tick, Price: uint32(i)}
+		if err := store.Append("acme", tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+			t.Fatalf("error appending: %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := store.Reader("acme", 0, math.MaxUint64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfs.files = nil
+	i := 0
+	_, _, err = reader.Next()
+	for err == nil {
+		i += 1
+		_, _, err = reader.Next()
+	}
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+	if i != 300 || len(mfs.files) != 5 {
+		t.Fatalf("got %d items from %d partitions", i, len(mfs.files))
+	}
+	// The partitions read are unmapped
+	for _, file := range mfs.files {
+		if file.mmap != nil {
+			t.Fatalf("partition %s not unmapped", file.Name())
+		}
+	}
+}
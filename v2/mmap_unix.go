@@ -0,0 +1,15 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package gotickfile
+
+import (
+	"github.com/melaurent/kafero"
+	"syscall"
+)
+
+// The mapping is private and writable, the few bytes modified when opening
+// the data are copied on write and never reach the file.
+func mmapFile(file kafero.File, size int) ([]byte, error) {
+	return file.Mmap(0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE)
+}
@@ -0,0 +1,135 @@
+package gotickfile
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Observer is notified of the events of a tick file, to log them or
+// collect metrics. The methods are called synchronously and should not
+// block.
+type Observer interface {
+	// OnWrite is called for each tick group written, with its number of
+	// items, by Write as by WriteBatch. Empty groups are not reported.
+	OnWrite(name string, tick uint64, count int)
+	// OnFlush is called after each flush with the bytes written to the file
+	OnFlush(name string, bytes int, latency time.Duration)
+	// OnRecover is called when a file with a partially written last
+	// block is opened, size being the size in bytes of the valid part of
+	// the file, from its start to the end of the last valid item or block
+	OnRecover(name string, size int64)
+	// OnOutOfOrder is called when a write is rejected, or reported as a
+	// late arrival, because its tick is before the last tick written
+	OnOutOfOrder(name string, tick uint64, lastTick uint64)
+}
+
+// WithObserver notifies the observer of the events of the file.
+func WithObserver(observer Observer) TickFileConfig {
+	return func(tf *TickFile) {
+		tf.observer = observer
+	}
+}
+
+type nopObserver struct{}
+
+func (nopObserver) OnWrite(string, uint64, int)         {}
+func (nopObserver) OnFlush(string, int, time.Duration)  {}
+func (nopObserver) OnRecover(string, int64)             {}
+func (nopObserver) OnOutOfOrder(string, uint64, uint64) {}
+
+// recovered reports the recovery of a file, once the valid part of the
+// file is loaded
+func (tf *TickFile) recovered() {
+	size := tf.offset
+	if tf.blockSection == nil {
+		// tf.offset is the end of the data read, the valid data of a
+		// stream file ends with its block
+		size = tf.header.ItemStart + tf.dataBase + int64(len(tf.block.Bytes()))
+	}
+	tf.observe().OnRecover(tf.file.Name(), size)
+}
+
+func (tf *TickFile) observe() Observer {
+	if tf.observer == nil {
+		return nopObserver{}
+	}
+	return tf.observer
+}
+
+// CounterObserver counts the events of one or many files. The counters can
+// be published with expvar or written in the Prometheus text format.
+type CounterObserver struct {
+	writes       int64
+	items        int64
+	flushes      int64
+	bytesWritten int64
+	flushNanos   int64
+	recoveries   int64
+	outOfOrders  int64
+}
+
+func NewCounterObserver() *CounterObserver {
+	return &CounterObserver{}
+}
+
+func (o *CounterObserver) OnWrite(name string, tick uint64, count int) {
+	atomic.AddInt64(&o.writes, 1)
+	atomic.AddInt64(&o.items, int64(count))
+}
+
+func (o *CounterObserver) OnFlush(name string, bytes int, latency time.Duration) {
+	atomic.AddInt64(&o.flushes, 1)
+	atomic.AddInt64(&o.bytesWritten, int64(bytes))
+	atomic.AddInt64(&o.flushNanos, int64(latency))
+}
+
+func (o *CounterObserver) OnRecover(name string, size int64) {
+	atomic.AddInt64(&o.recoveries, 1)
+}
+
+func (o *CounterObserver) OnOutOfOrder(name string, tick uint64, lastTick uint64) {
+	atomic.AddInt64(&o.outOfOrders, 1)
+}
+
+// Counters returns the current value of the counters by name
+func (o *CounterObserver) Counters() map[string]int64 {
+	return map[string]int64{
+		"writes_total":              atomic.LoadInt64(&o.writes),
+		"items_total":               atomic.LoadInt64(&o.items),
+		"flushes_total":             atomic.LoadInt64(&o.flushes),
+		"bytes_written_total":       atomic.LoadInt64(&o.bytesWritten),
+		"flush_duration_ns_total":   atomic.LoadInt64(&o.flushNanos),
+		"corruption_recovery_total": atomic.LoadInt64(&o.recoveries),
+		"out_of_order_total":        atomic.LoadInt64(&o.outOfOrders),
+	}
+}
+
+// Publish publishes the counters with expvar under the given name.
+func (o *CounterObserver) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return o.Counters()
+	}))
+}
+
+// WritePrometheus writes the counters in the Prometheus text format, the
+// metric names being prefixed with prefix.
+func (o *CounterObserver) WritePrometheus(w io.Writer, prefix string) error {
+	counters := o.Counters()
+	for _, name := range []string{
+		"writes_total",
+		"items_total",
+		"flushes_total",
+		"bytes_written_total",
+		"flush_duration_ns_total",
+		"corruption_recovery_total",
+		"out_of_order_total",
+	} {
+		if _, err := fmt.Fprintf(w, "# TYPE %s_%s counter\n%s_%s %d\n", prefix, name, prefix, name, counters[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
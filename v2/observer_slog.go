@@ -0,0 +1,38 @@
+//go:build go1.21
+// +build go1.21
+
+package gotickfile
+
+import (
+	"log/slog"
+	"time"
+)
+
+// SlogObserver logs the events of tick files with a slog logger. Writes
+// and flushes are logged at the debug level.
+type SlogObserver struct {
+	logger *slog.Logger
+}
+
+func NewSlogObserver(logger *slog.Logger) *SlogObserver {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogObserver{logger: logger}
+}
+
+func (o *SlogObserver) OnWrite(name string, tick uint64, count int) {
+	o.logger.Debug("tickfile write", "file", name, "tick", tick, "count", count)
+}
+
+func (o *SlogObserver) OnFlush(name string, bytes int, latency time.Duration) {
+	o.logger.Debug("tickfile flush", "file", name, "bytes", bytes, "latency", latency)
+}
+
+func (o *SlogObserver) OnRecover(name string, size int64) {
+	o.logger.Warn("tickfile recovered from partially written block", "file", name, "size", size)
+}
+
+func (o *SlogObserver) OnOutOfOrder(name string, tick uint64, lastTick uint64) {
+	o.logger.Warn("tickfile tick out of order", "file", name, "tick", tick, "last_tick", lastTick)
+}
@@ -0,0 +1,120 @@
+//go:build go1.21
+// +build go1.21
+
+package gotickfile
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+// recordingHandler records the logged records
+type recordingHandler struct {
+	sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.Lock()
+	defer h.Unlock()
+	h.records = append(h.records, r.Clone())
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *recordingHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// messages returns the records of the message, with their attributes by key
+func (h *recordingHandler) messages(msg string) []map[string]slog.Value {
+	h.Lock()
+	defer h.Unlock()
+	var res []map[string]slog.Value
+	for _, r := range h.records {
+		if r.Message != msg {
+			continue
+		}
+		attrs := map[string]slog.Value{"level": slog.StringValue(r.Level.String())}
+		r.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value
+			return true
+		})
+		res = append(res, attrs)
+	}
+	return res
+}
+
+func TestSlogObserver(t *testing.T) {
+	h := &recordingHandler{}
+	observer := NewSlogObserver(slog.New(h))
+	file, err := fs.Create("slog.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	tf, err := Create(file, WithDataType(reflect.TypeOf(Data{})), WithObserver(observer))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	deltas := []Data{data1, data2, data1}
+	if err := tf.Write(10, TickDeltas{Pointer: unsafe.Pointer(&deltas[0]), Len: 2}); err != nil {
+		t.Fatalf("error writing: %v", err)
+	}
+	// The same events as writes of each group
+	if err := tf.WriteBatch([]uint64{11, 12, 13}, TickDeltas{Pointer: unsafe.Pointer(&deltas[0]), Len: 3}, []int{1, 0, 2}); err != nil {
+		t.Fatalf("error writing batch: %v", err)
+	}
+	if err := tf.Write(1, TickDeltas{Pointer: unsafe.Pointer(&deltas[0]), Len: 1}); err != ErrTickOutOfOrder {
+		t.Fatalf("was expecting out of order error, got %v", err)
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	writes := h.messages("tickfile write")
+	golden := [][2]uint64{{10, 2}, {11, 1}, {13, 2}}
+	if len(writes) != len(golden) {
+		t.Fatalf("got %d writes, was expecting %d", len(writes), len(golden))
+	}
+	for i, w := range writes {
+		if w["level"].String() != "DEBUG" || w["file"].String() != "slog.tick" ||
+			w["tick"].Uint64() != golden[i][0] || w["count"].Int64() != int64(golden[i][1]) {
+			t.Fatalf("got unexpected write record: %v", w)
+		}
+	}
+	outOfOrders := h.messages("tickfile tick out of order")
+	if len(outOfOrders) != 1 || outOfOrders[0]["level"].String() != "WARN" ||
+		outOfOrders[0]["tick"].Uint64() != 1 || outOfOrders[0]["last_tick"].Uint64() != 13 {
+		t.Fatalf("got unexpected out of order records: %v", outOfOrders)
+	}
+	flushes := h.messages("tickfile flush")
+	if len(flushes) != 1 || flushes[0]["bytes"].Int64() == 0 {
+		t.Fatalf("got unexpected flush records: %v", flushes)
+	}
+
+	// Remove the end of stream marker as if the recorder crashed
+	fi, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt([]byte{0}, fi.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenRead(file, reflect.TypeOf(Data{}), WithObserver(observer)); err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	if recoveries := h.messages("tickfile recovered from partially written block"); len(recoveries) != 1 || recoveries[0]["level"].String() != "WARN" {
+		t.Fatalf("got unexpected recovery records: %v", recoveries)
+	}
+}
@@ -0,0 +1,141 @@
+package gotickfile
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestCounterObserver(t *testing.T) {
+	observer := NewCounterObserver()
+	file, err := fs.Create("observer.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	tf, err := Create(
+		file,
+		WithDataType(reflect.TypeOf(Data{})),
+		WithObserver(observer))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		deltas := []Data{data1, data2}
+		if err := tf.Write(uint64(i+10), TickDeltas{Pointer: unsafe.Pointer(&deltas[0]), Len: 2}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+	}
+	if err := tf.Write(1, TickDeltas{Pointer: unsafe.Pointer(&data1), Len: 1}); err != ErrTickOutOfOrder {
+		t.Fatalf("was expecting out of order error, got %v", err)
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	counters := observer.Counters()
+	if counters["writes_total"] != 10 || counters["items_total"] != 20 {
+		t.Fatalf("got unexpected write counters: %v", counters)
+	}
+	if counters["out_of_order_total"] != 1 || counters["flushes_total"] != 1 {
+		t.Fatalf("got unexpected counters: %v", counters)
+	}
+	if counters["bytes_written_total"] == 0 {
+		t.Fatalf("was expecting bytes written")
+	}
+
+	var buf bytes.Buffer
+	if err := observer.WritePrometheus(&buf, "tickfile"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "tickfile_items_total 20\n") {
+		t.Fatalf("got unexpected prometheus output: %s", buf.String())
+	}
+
+	// Remove the end of stream marker as if the recorder crashed
+	fi, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt([]byte{0}, fi.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenRead(file, reflect.TypeOf(Data{}), WithObserver(observer)); err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	if observer.Counters()["corruption_recovery_total"] != 1 {
+		t.Fatalf("was expecting a corruption recovery")
+	}
+}
+
+type recoverObserver struct {
+	nopObserver
+	sizes []int64
+}
+
+func (o *recoverObserver) OnRecover(name string, size int64) {
+	o.sizes = append(o.sizes, size)
+}
+
+func TestObserverRecoverSize(t *testing.T) {
+	// A columnar file with a leftover after its tail block
+	writeColumnarFile(t, "observer_columnar.tick", 64, 500)
+	file, err := fs.OpenFile("observer_columnar.tick", 2, 0644)
+	if err != nil {
+		t.Fatalf("error opening file: %v", err)
+	}
+	tf, err := OpenRead(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	tail := tf.blocks.blocks[len(tf.blocks.blocks)-1]
+	size := tail.offset + tail.size
+	if _, err := file.WriteAt(make([]byte, 16), size); err != nil {
+		t.Fatal(err)
+	}
+	observer := &recoverObserver{}
+	if _, err := OpenRead(file, reflect.TypeOf(Data{}), WithObserver(observer)); err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	if _, err := OpenWrite(file, reflect.TypeOf(Data{}), WithObserver(observer)); err != nil {
+		t.Fatalf("error opening tickfile for writing: %v", err)
+	}
+	if len(observer.sizes) != 2 || observer.sizes[0] != size || observer.sizes[1] != size {
+		t.Fatalf("got recovered sizes %v, was expecting %d", observer.sizes, size)
+	}
+
+	// A stream file without its end of stream marker
+	file, err = fs.Create("observer_stream.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	tf, err = Create(file, WithDataType(reflect.TypeOf(Data{})))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		deltas := []Data{data1, data2}
+		if err := tf.Write(uint64(i+10), TickDeltas{Pointer: unsafe.Pointer(&deltas[0]), Len: 2}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt([]byte{0}, fi.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+	observer = &recoverObserver{}
+	tf, err = OpenRead(file, reflect.TypeOf(Data{}), WithObserver(observer))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	if len(observer.sizes) != 1 || observer.sizes[0] <= tf.header.ItemStart || observer.sizes[0] >= fi.Size() {
+		t.Fatalf("got recovered sizes %v, was expecting the size of the valid items", observer.sizes)
+	}
+}
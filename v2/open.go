@@ -0,0 +1,131 @@
+package gotickfile
+
+import (
+	"fmt"
+	gotickfilev1 "github.com/melaurent/gotickfile"
+	"github.com/melaurent/kafero"
+	"io"
+	"reflect"
+	"unsafe"
+)
+
+// TickReader is the reader returned by Open, over a v1 or a v2 file. The
+// deltas returned by Next are only valid until the next call.
+type TickReader interface {
+	Next() (uint64, TickDeltas, error)
+	DeltaType() reflect.Type
+	GetNameValues() map[string]interface{}
+	GetTags() map[string]string
+	GetContentDescription() *string
+	// Close closes the tickfile, the file itself is left open
+	Close() error
+}
+
+// Open opens a v1 or a v2 file for reading, the version being detected
+// from the magic value of the file.
+func Open(file kafero.File, typ reflect.Type) (TickReader, error) {
+	v1, err := isV1(file)
+	if err != nil {
+		return nil, err
+	}
+	if v1 {
+		tf, err := gotickfilev1.OpenRead(file, typ)
+		if err != nil {
+			return nil, fmt.Errorf("error opening tickfile v1: %w", err)
+		}
+		return &v1Reader{tf: tf, typ: typ}, nil
+	}
+
+	tf, err := OpenRead(file, typ)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := tf.GetTickReader()
+	if err != nil {
+		_ = tf.Close()
+		return nil, err
+	}
+	return &v2Reader{tf: tf, reader: reader}, nil
+}
+
+// isV1 returns true if the file has the magic value of v1 files
+func isV1(file kafero.File) (bool, error) {
+	var magic [8]byte
+	if _, err := file.ReadAt(magic[:], 0); err != nil {
+		return false, fmt.Errorf("error reading magic value: %w", err)
+	}
+	// v1 files are always in the native byte order
+	return nativeEndian.Uint64(magic[:]) == magicValueV1, nil
+}
+
+type v2Reader struct {
+	tf     *TickFile
+	reader *CTickReader
+}
+
+func (r *v2Reader) Next() (uint64, TickDeltas, error) {
+	return r.reader.Next()
+}
+
+func (r *v2Reader) DeltaType() reflect.Type {
+	return r.reader.DeltaType()
+}
+
+func (r *v2Reader) GetNameValues() map[string]interface{} {
+	return r.tf.GetNameValues()
+}
+
+func (r *v2Reader) GetTags() map[string]string {
+	return r.tf.GetTags()
+}
+
+func (r *v2Reader) GetContentDescription() *string {
+	return r.tf.GetContentDescription()
+}
+
+func (r *v2Reader) Close() error {
+	return r.tf.Close()
+}
+
+// v1Reader returns the items of a v1 file grouped by tick
+type v1Reader struct {
+	tf  *gotickfilev1.TickFile
+	typ reflect.Type
+	idx int
+}
+
+func (r *v1Reader) Next() (uint64, TickDeltas, error) {
+	n, tick, items, err := r.tf.Read(r.idx)
+	if err != nil {
+		return 0, TickDeltas{}, err
+	}
+	if n == 0 {
+		return 0, TickDeltas{}, io.EOF
+	}
+	r.idx += n
+	// The items are a pointer to a slice
+	return tick, TickDeltas{
+		Pointer: unsafe.Pointer(reflect.ValueOf(items).Elem().Pointer()),
+		Len:     n,
+	}, nil
+}
+
+func (r *v1Reader) DeltaType() reflect.Type {
+	return r.typ
+}
+
+func (r *v1Reader) GetNameValues() map[string]interface{} {
+	return r.tf.GetNameValues()
+}
+
+func (r *v1Reader) GetTags() map[string]string {
+	return r.tf.GetTags()
+}
+
+func (r *v1Reader) GetContentDescription() *string {
+	return r.tf.GetContentDescription()
+}
+
+func (r *v1Reader) Close() error {
+	return r.tf.Close()
+}
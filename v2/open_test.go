@@ -0,0 +1,116 @@
+package gotickfile
+
+import (
+	gotickfilev1 "github.com/melaurent/gotickfile"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func checkTickReader(t *testing.T, reader TickReader, ticks []uint64, goldenDeltas []Data) {
+	i := 0
+	for {
+		tick, deltas, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < deltas.Len; j++ {
+			if tick != ticks[i] {
+				t.Fatalf("got different tick: %d %d", tick, ticks[i])
+			}
+			d := *(*Data)(unsafe.Pointer(uintptr(deltas.Pointer) + uintptr(j)*unsafe.Sizeof(Data{})))
+			if d != goldenDeltas[i] {
+				t.Fatalf("got different data: %v %v", d, goldenDeltas[i])
+			}
+			i += 1
+		}
+		if i < len(ticks) && ticks[i] == tick {
+			t.Fatalf("group for tick %d was split", tick)
+		}
+	}
+	if i != len(ticks) {
+		t.Fatalf("got %d items, was expecting %d", i, len(ticks))
+	}
+}
+
+func TestOpen(t *testing.T) {
+	v1, err := fs.Create("v1.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	v2, err := fs.Create("v2.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	tags := map[string]string{"tag1": "v1"}
+	tfv1, err := gotickfilev1.Create(
+		v1,
+		gotickfilev1.WithDataType(reflect.TypeOf(Data{})),
+		gotickfilev1.WithTags(tags))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	tfv2, err := Create(v2, WithDataType(reflect.TypeOf(Data{})), WithTags(tags))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+
+	var ticks []uint64
+	var goldenDeltas []Data
+	for i := 0; i < 1000; i++ {
+		tick := uint64(i / 3)
+		delta := Data{Time: uint64(i), Price: uint32(rand.Int()), Prib: uint64(rand.Int())}
+		deltas := []Data{delta}
+		if err := tfv1.Write(tick, &deltas); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+		if err := tfv2.Write(tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+		ticks = append(ticks, tick)
+		goldenDeltas = append(goldenDeltas, delta)
+	}
+	if err := tfv1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tfv2.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{"v1.tick", "v2.tick"} {
+		f, err := fs.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := Open(f, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening %s: %v", file, err)
+		}
+		if reader.DeltaType() != reflect.TypeOf(Data{}) {
+			t.Fatalf("got different delta type: %s", reader.DeltaType())
+		}
+		if !reflect.DeepEqual(reader.GetTags(), tags) {
+			t.Fatalf("got different tags: %v", reader.GetTags())
+		}
+		checkTickReader(t, reader, ticks, goldenDeltas)
+		if err := reader.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	empty, err := fs.Create("empty.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	if _, err := Open(empty, reflect.TypeOf(Data{})); err == nil {
+		t.Fatalf("was expecting an error on an empty file")
+	}
+}
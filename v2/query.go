@@ -0,0 +1,266 @@
+package gotickfile
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+type AggregateOp uint8
+
+const (
+	// Number of items
+	AGG_COUNT AggregateOp = iota
+	AGG_SUM
+	AGG_MIN
+	AGG_MAX
+	AGG_MEAN
+	// Value of the first item, in tick order
+	AGG_FIRST
+	// Value of the last item, in tick order
+	AGG_LAST
+)
+
+// Aggregation computes a value over a numeric field of the items
+type Aggregation struct {
+	Op    AggregateOp
+	Field string
+}
+
+func Count() Aggregation {
+	return Aggregation{Op: AGG_COUNT}
+}
+
+func Sum(field string) Aggregation {
+	return Aggregation{Op: AGG_SUM, Field: field}
+}
+
+func Min(field string) Aggregation {
+	return Aggregation{Op: AGG_MIN, Field: field}
+}
+
+func Max(field string) Aggregation {
+	return Aggregation{Op: AGG_MAX, Field: field}
+}
+
+func Mean(field string) Aggregation {
+	return Aggregation{Op: AGG_MEAN, Field: field}
+}
+
+func First(field string) Aggregation {
+	return Aggregation{Op: AGG_FIRST, Field: field}
+}
+
+func Last(field string) Aggregation {
+	return Aggregation{Op: AGG_LAST, Field: field}
+}
+
+// QueryRow holds the values of the aggregations of a group, in the order
+// of the aggregations.
+type QueryRow struct {
+	// First tick of the interval of the group, 0 without GroupBy
+	Tick   uint64
+	Values []float64
+}
+
+// TickQuery aggregates the items of tick files, built with Query.
+type TickQuery struct {
+	files    []*TickFile
+	configs  []TickReaderConfig
+	interval uint64
+	aggs     []Aggregation
+}
+
+// Query starts a query over the items of the files, merged in tick order.
+// The files can have different data types, as long as they have the
+// fields used by the query.
+func Query(files ...*TickFile) *TickQuery {
+	return &TickQuery{files: files}
+}
+
+// Where only aggregates the items whose field compares to value with op,
+// as WithFilter.
+func (q *TickQuery) Where(field string, op FilterOp, value interface{}) *TickQuery {
+	q.configs = append(q.configs, WithFilter(field, op, value))
+	return q
+}
+
+// Between only aggregates the items with a tick in [from, to).
+func (q *TickQuery) Between(from, to uint64) *TickQuery {
+	q.configs = append(q.configs, WithTickRange(from, to))
+	return q
+}
+
+// GroupBy aggregates the items by intervals of interval ticks, starting at
+// tick 0. Without it, all the items are aggregated in one group.
+func (q *TickQuery) GroupBy(interval uint64) *TickQuery {
+	q.interval = interval
+	return q
+}
+
+// Agg adds aggregations to compute for each group
+func (q *TickQuery) Agg(aggs ...Aggregation) *TickQuery {
+	q.aggs = append(q.aggs, aggs...)
+	return q
+}
+
+// queryField is a numeric field of the items of a source
+type queryField struct {
+	typ    uint8
+	offset uintptr
+}
+
+// aggregate holds the running value of an aggregation in a group
+type aggregate struct {
+	value float64
+	count uint64
+}
+
+func (a *aggregate) add(op AggregateOp, v float64) {
+	switch op {
+	case AGG_SUM, AGG_MEAN:
+		a.value += v
+	case AGG_MIN:
+		if a.count == 0 || v < a.value {
+			a.value = v
+		}
+	case AGG_MAX:
+		if a.count == 0 || v > a.value {
+			a.value = v
+		}
+	case AGG_FIRST:
+		if a.count == 0 {
+			a.value = v
+		}
+	case AGG_LAST:
+		a.value = v
+	}
+	a.count += 1
+}
+
+func (a *aggregate) result(op AggregateOp) float64 {
+	switch op {
+	case AGG_COUNT:
+		return float64(a.count)
+	case AGG_MEAN:
+		return a.value / float64(a.count)
+	default:
+		return a.value
+	}
+}
+
+// readers returns a reader of each file, decoding only the fields of the
+// query in columnar files, and the fields of the aggregations in each one
+func (q *TickQuery) readers() ([]*CTickReader, [][]queryField, error) {
+	var names []string
+	for _, agg := range q.aggs {
+		if agg.Op != AGG_COUNT {
+			names = append(names, agg.Field)
+		}
+	}
+	configs := q.configs
+	if len(names) > 0 {
+		configs = append(configs[:len(configs):len(configs)], WithFields(names...))
+	}
+	var readers []*CTickReader
+	var fields [][]queryField
+	for i, tf := range q.files {
+		reader, err := tf.GetTickReader(configs...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error getting reader of file %d: %w", i, err)
+		}
+		fs := make([]queryField, len(q.aggs))
+		for j, agg := range q.aggs {
+			if agg.Op == AGG_COUNT {
+				continue
+			}
+			indices, err := reader.info.fieldIndices(agg.Field)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error in file %d: %w", i, err)
+			}
+			if len(indices) != 1 {
+				return nil, nil, fmt.Errorf("cannot aggregate array field %s", agg.Field)
+			}
+			field := reader.info.Fields[indices[0]]
+			if !isNumeric(field.Type) {
+				return nil, nil, fmt.Errorf("cannot aggregate non numeric field %s", agg.Field)
+			}
+			fs[j] = queryField{typ: field.Type, offset: uintptr(field.Offset)}
+		}
+		readers = append(readers, reader)
+		fields = append(fields, fs)
+	}
+	return readers, fields, nil
+}
+
+// Run runs the query and returns a row for each group with items, in tick
+// order. The values are computed as float64.
+func (q *TickQuery) Run() ([]QueryRow, error) {
+	return q.RunContext(context.Background())
+}
+
+// RunContext is like Run, but stops when the context is done, returning
+// the context error.
+func (q *TickQuery) RunContext(ctx context.Context) ([]QueryRow, error) {
+	readers, fields, err := q.readers()
+	if err != nil {
+		return nil, err
+	}
+	merged := MergeReaders(readers...)
+
+	var rows []QueryRow
+	aggs := make([]aggregate, len(q.aggs))
+	// end sets the values of the last row
+	end := func() {
+		if len(rows) == 0 {
+			return
+		}
+		values := make([]float64, len(q.aggs))
+		for i := range aggs {
+			values[i] = aggs[i].result(q.aggs[i].Op)
+			aggs[i] = aggregate{}
+		}
+		rows[len(rows)-1].Values = values
+	}
+	for i := 0; ; i++ {
+		if i%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		source, tick, deltas, err := merged.NextContext(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading file %d: %w", source, err)
+		}
+		if deltas.Len == 0 {
+			continue
+		}
+		var start uint64
+		if q.interval > 0 {
+			start = tick - tick%q.interval
+		}
+		if len(rows) == 0 || rows[len(rows)-1].Tick != start {
+			end()
+			rows = append(rows, QueryRow{Tick: start})
+		}
+		size := readers[source].typ.Size()
+		for k := 0; k < deltas.Len; k++ {
+			item := unsafe.Pointer(uintptr(deltas.Pointer) + uintptr(k)*size)
+			for j, agg := range q.aggs {
+				if agg.Op == AGG_COUNT {
+					aggs[j].count += 1
+					continue
+				}
+				f := fields[source][j]
+				n, _ := fieldNumber(f.typ, unsafe.Pointer(uintptr(item)+f.offset))
+				aggs[j].add(agg.Op, n.Float64())
+			}
+		}
+	}
+	end()
+	return rows, nil
+}
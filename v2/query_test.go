@@ -0,0 +1,122 @@
+package gotickfile
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"unsafe"
+)
+
+type Print struct {
+	Price  float64
+	Volume uint32
+	Flags  [2]uint8
+}
+
+func TestQuery(t *testing.T) {
+	type item struct {
+		source int
+		tick   uint64
+		price  float64
+		volume float64
+	}
+	var items []item
+
+	data, err := CreateInMemory(WithDataType(reflect.TypeOf(Data{})))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	prints, err := CreateInMemory(WithDataType(reflect.TypeOf(Print{})), WithColumnarLayout(50))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	var tick uint64 = 0
+	for i := 0; i < 1000; i++ {
+		tick += uint64(rand.Intn(3))
+		delta := Data{Price: uint32(rand.Intn(200)), Volume: uint64(rand.Intn(10))}
+		if err := data.Write(tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+		items = append(items, item{source: 0, tick: tick, price: float64(delta.Price), volume: float64(delta.Volume)})
+	}
+	tick = 0
+	for i := 0; i < 1000; i++ {
+		tick += uint64(rand.Intn(3))
+		delta := Print{Price: float64(rand.Intn(800)) / 4, Volume: uint32(rand.Intn(10))}
+		if err := prints.Write(tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+		items = append(items, item{source: 1, tick: tick, price: delta.Price, volume: float64(delta.Volume)})
+	}
+	if err := prints.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// Items in the order of the merged reader
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].tick == items[j].tick {
+			return items[i].source < items[j].source
+		}
+		return items[i].tick < items[j].tick
+	})
+
+	var golden []QueryRow
+	for _, it := range items {
+		if it.price <= 100 || it.tick < 50 || it.tick >= 900 {
+			continue
+		}
+		start := it.tick - it.tick%100
+		if n := len(golden); n == 0 || golden[n-1].Tick != start {
+			golden = append(golden, QueryRow{Tick: start, Values: []float64{0, 0, it.price, it.price, 0, it.price, 0}})
+		}
+		v := golden[len(golden)-1].Values
+		v[0] += 1
+		v[1] += it.volume
+		if it.price > v[2] {
+			v[2] = it.price
+		}
+		if it.price < v[3] {
+			v[3] = it.price
+		}
+		v[4] += it.price
+		v[6] = it.price
+	}
+	for _, row := range golden {
+		row.Values[4] /= row.Values[0]
+	}
+
+	rows, err := Query(data, prints).
+		Where("Price", FILTER_GT, 100).
+		Between(50, 900).
+		GroupBy(100).
+		Agg(Count(), Sum("Volume"), Max("Price"), Min("Price"), Mean("Price"), First("Price"), Last("Price")).
+		Run()
+	if err != nil {
+		t.Fatalf("error running query: %v", err)
+	}
+	if !reflect.DeepEqual(rows, golden) {
+		t.Fatalf("got different rows: %v %v", rows, golden)
+	}
+
+	// Without group, one row
+	rows, err = Query(data).Agg(Count(), Sum("Volume")).Run()
+	if err != nil {
+		t.Fatalf("error running query: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Tick != 0 || rows[0].Values[0] != 1000 {
+		t.Fatalf("got different rows: %v", rows)
+	}
+
+	if _, err := Query(data, prints).Agg(Sum("Prib")).Run(); err == nil {
+		t.Fatalf("was expecting an error for a missing field")
+	}
+	if _, err := Query(prints).Agg(Sum("Flags")).Run(); err == nil {
+		t.Fatalf("was expecting an error for an array field")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Query(data).Agg(Count()).RunContext(ctx); err != context.Canceled {
+		t.Fatalf("was expecting context canceled, got %v", err)
+	}
+}
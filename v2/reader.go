@@ -1,9 +1,12 @@
 package gotickfile
 
 import (
+	"context"
+	"fmt"
 	"github.com/melaurent/gotickfile/v2/compress"
 	"io"
 	"reflect"
+	"unsafe"
 )
 
 type CTickReader struct {
@@ -15,12 +18,27 @@ type CTickReader struct {
 	typ      reflect.Type
 	tickC    *compress.TickDecompress
 	structC  *StructDecompress
+	cr       *columnReader
+	fields   []string
+	filters  []fieldFilter
+	ranged   bool
+	from     uint64
+	to       uint64
+	fval     []byte
+	copy     bool
+	// Byte swaps of the items of a file with a foreign byte order
+	swaps []byteSwap
+	// Guard of the mapping read, if any
+	guard *mapGuard
 }
 
 type CTickReaderState struct {
 	tick     uint64
 	nextTick uint64
 	br       compress.BitReaderState
+	// State of the decompressors, empty before the first item
+	dec []byte
+	cr  columnReaderState
 }
 
 func NewCTickReader(info *ItemSection, typ reflect.Type, br *compress.BitReader) (*CTickReader, error) {
@@ -36,25 +54,188 @@ func NewCTickReader(info *ItemSection, typ reflect.Type, br *compress.BitReader)
 	return r, nil
 }
 
+// WithCopy returns the deltas of Next in a new array owned by the caller,
+// instead of memory reused by the reader.
+func WithCopy() TickReaderConfig {
+	return func(r *CTickReader) {
+		r.copy = true
+	}
+}
+
 func (r *CTickReader) DeltaType() reflect.Type {
 	return r.typ
 }
 
+// ItemSection returns the item section describing the fields of the deltas
+func (r *CTickReader) ItemSection() *ItemSection {
+	return r.info
+}
+
+// State returns the state of the reader, to move back or forward to it
+// with Reset
 func (r *CTickReader) State() CTickReaderState {
-	return CTickReaderState{
-		tick:     r.tick,
-		nextTick: r.nextTick,
-		br:       r.br.State(),
+	var state CTickReaderState
+	r.SaveState(&state)
+	return state
+}
+
+// SaveState is like State, but saves the state of the reader to state,
+// reusing its memory. It does not allocate once a state of the reader has
+// been saved to state, to look ahead of each group for instance.
+func (r *CTickReader) SaveState(state *CTickReaderState) {
+	if r.cr != nil {
+		r.cr.SaveState(&state.cr)
+		return
+	}
+	state.tick = r.tick
+	state.nextTick = r.nextTick
+	state.br = r.br.State()
+	state.dec = state.dec[:0]
+	if r.tickC != nil && r.structC != nil {
+		state.dec = appendState(state.dec, r.tickC, r.structC)
 	}
 }
 
-func (r *CTickReader) Reset(state CTickReaderState) {
+// Reset moves the reader back, or forward, to a state returned by State,
+// for instance to look ahead of the current group. The reader is left
+// unchanged if the state can't be restored.
+func (r *CTickReader) Reset(state CTickReaderState) error {
+	if r.guard != nil {
+		if !r.guard.acquire() {
+			return ErrClosed
+		}
+		defer r.guard.RUnlock()
+	}
+	if r.cr != nil {
+		return r.cr.Reset(&state.cr)
+	}
+	tickC, structC := r.tickC, r.structC
+	if len(state.dec) == 0 {
+		tickC, structC = nil, nil
+	} else if tickC != nil && structC != nil {
+		// The decompressors are reused, the state was saved from
+		// decompressors of the same items
+		if err := restoreState(r.info, tickC, structC, state.dec); err != nil {
+			return fmt.Errorf("error restoring reader state: %w", err)
+		}
+	} else {
+		var err error
+		tickC, structC, err = decompressFromState(r.info, r.typ, state.dec)
+		if err != nil {
+			return fmt.Errorf("error restoring reader state: %w", err)
+		}
+	}
 	r.tick = state.tick
 	r.nextTick = state.nextTick
 	r.br.Reset(state.br)
+	r.tickC = tickC
+	r.structC = structC
+	return nil
 }
 
+// Next returns the next tick and its deltas. The deltas are owned by the
+// reader and are only valid until the next call, unless the reader was
+// created with WithCopy.
 func (r *CTickReader) Next() (uint64, TickDeltas, error) {
+	tick, delta, err := r.nextDeltas(context.Background())
+	if r.copy && delta.Len > 0 {
+		delta = r.copyDeltas(delta)
+	}
+	return tick, delta, err
+}
+
+// NextInto is like Next, but copies the deltas to dst, a pointer to a slice
+// of the delta type. The slice is resized to the number of deltas, reusing
+// its array when it is large enough, and is never modified by the reader
+// after the call returns.
+func (r *CTickReader) NextInto(dst interface{}) (uint64, error) {
+	expectedType := reflect.PtrTo(reflect.SliceOf(r.typ))
+	if reflect.TypeOf(dst) != expectedType {
+		return 0, fmt.Errorf("was expecting pointer to slice of %s, got %s", r.typ, reflect.TypeOf(dst))
+	}
+	v := reflect.ValueOf(dst)
+	if v.IsNil() {
+		return 0, fmt.Errorf("got nil pointer to slice")
+	}
+	s := v.Elem()
+	tick, delta, err := r.nextDeltas(context.Background())
+	if err != nil {
+		s.SetLen(0)
+		return tick, err
+	}
+	if s.Cap() < delta.Len {
+		s.Set(reflect.MakeSlice(s.Type(), delta.Len, delta.Len))
+	} else {
+		s.SetLen(delta.Len)
+	}
+	if delta.Len > 0 {
+		size := delta.Len * int(r.typ.Size())
+		copy(unsafeBytes(unsafe.Pointer(s.Pointer()), size), unsafeBytes(delta.Pointer, size))
+	}
+	return tick, nil
+}
+
+// copyDeltas copies the deltas to a new array
+func (r *CTickReader) copyDeltas(delta TickDeltas) TickDeltas {
+	s := reflect.MakeSlice(reflect.SliceOf(r.typ), delta.Len, delta.Len)
+	ptr := unsafe.Pointer(s.Pointer())
+	size := delta.Len * int(r.typ.Size())
+	copy(unsafeBytes(ptr, size), unsafeBytes(delta.Pointer, size))
+	return TickDeltas{Pointer: ptr, Len: delta.Len}
+}
+
+// nextDeltas returns the next group passing the filters and the range,
+// checking the context while skipping the others
+func (r *CTickReader) nextDeltas(ctx context.Context) (uint64, TickDeltas, error) {
+	if r.guard != nil {
+		if !r.guard.acquire() {
+			return r.tick, TickDeltas{Pointer: nil, Len: 0}, ErrClosed
+		}
+		defer r.guard.RUnlock()
+	}
+	if len(r.filters) == 0 && !r.ranged {
+		return r.next(ctx)
+	}
+	for i := 1; ; i++ {
+		if i%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return r.tick, TickDeltas{Pointer: nil, Len: 0}, err
+			}
+		}
+		tick, delta, err := r.next(ctx)
+		if err != nil {
+			return tick, delta, err
+		}
+		if r.ranged {
+			if tick < r.from {
+				continue
+			}
+			if tick >= r.to {
+				return tick, TickDeltas{Pointer: nil, Len: 0}, io.EOF
+			}
+		}
+		if len(r.filters) > 0 {
+			delta = r.filter(delta)
+			if delta.Len == 0 {
+				continue
+			}
+		}
+		return tick, delta, nil
+	}
+}
+
+func (r *CTickReader) next(ctx context.Context) (uint64, TickDeltas, error) {
+	tick, delta, err := r.decode(ctx)
+	if len(r.swaps) > 0 && delta.Len > 0 {
+		swapItems(delta.Pointer, delta.Len, r.typ.Size(), r.swaps)
+	}
+	return tick, delta, err
+}
+
+func (r *CTickReader) decode(ctx context.Context) (uint64, TickDeltas, error) {
+	if r.cr != nil {
+		return r.cr.Next(ctx)
+	}
 	delta := TickDeltas{
 		Pointer: nil,
 		Len:     0,
@@ -0,0 +1,104 @@
+package gotickfile
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func writeGroups(t *testing.T, name string) *TickFile {
+	file, err := fs.Create(name)
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	tf, err := Create(file, WithDataType(reflect.TypeOf(Data{})))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	// Tick i has i+1 deltas
+	for i := 0; i < 20; i++ {
+		for j := 0; j <= i; j++ {
+			delta := Data{Time: uint64(i), Price: uint32(j)}
+			if err := tf.Write(uint64(i), TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+				t.Fatalf("error writing: %v", err)
+			}
+		}
+	}
+	if err := tf.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return tf
+}
+
+func TestReaderWithCopy(t *testing.T) {
+	tf := writeGroups(t, "copy.tick")
+	reader, err := tf.GetTickReader(WithCopy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []TickDeltas
+	for {
+		_, deltas, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		kept = append(kept, deltas)
+	}
+	if len(kept) != 20 {
+		t.Fatalf("got %d ticks, was expecting 20", len(kept))
+	}
+	// The deltas are still valid after the following calls
+	for i, deltas := range kept {
+		if deltas.Len != i+1 {
+			t.Fatalf("got %d deltas, was expecting %d", deltas.Len, i+1)
+		}
+		for j := 0; j < deltas.Len; j++ {
+			d := *(*Data)(unsafe.Pointer(uintptr(deltas.Pointer) + uintptr(j)*unsafe.Sizeof(Data{})))
+			if d.Time != uint64(i) || d.Price != uint32(j) {
+				t.Fatalf("got different delta at %d %d: %v", i, j, d)
+			}
+		}
+	}
+}
+
+func TestReaderNextInto(t *testing.T) {
+	tf := writeGroups(t, "copy.tick")
+	reader, err := tf.GetTickReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.NextInto(&[]int{}); err == nil {
+		t.Fatalf("was expecting an error with a different type")
+	}
+	var previous []Data
+	dst := make([]Data, 0, 4)
+	for i := 0; i < 20; i++ {
+		tick, err := reader.NextInto(&dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tick != uint64(i) || len(dst) != i+1 {
+			t.Fatalf("got tick %d with %d deltas", tick, len(dst))
+		}
+		for j := range dst {
+			if dst[j].Time != uint64(i) || dst[j].Price != uint32(j) {
+				t.Fatalf("got different delta at %d %d: %v", i, j, dst[j])
+			}
+		}
+		// The slice of the previous call is not modified
+		for j := range previous {
+			if previous[j].Time != uint64(i-1) {
+				t.Fatalf("previous slice was modified")
+			}
+		}
+		previous = dst
+		dst = nil
+	}
+	if _, err := reader.NextInto(&dst); err != io.EOF {
+		t.Fatalf("was expecting EOF, got %v", err)
+	}
+}
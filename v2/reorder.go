@@ -0,0 +1,170 @@
+package gotickfile
+
+import (
+	"container/heap"
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// WithReorderWindow holds the writes in a buffer until the highest tick
+// written is window ticks past them, and writes them sorted by tick, so
+// writes can arrive out of order by up to window ticks. Items of the same
+// tick keep their arrival order. Flush only writes the items out of the
+// window, Close writes them all.
+func WithReorderWindow(window uint64) TickFileConfig {
+	return func(tf *TickFile) {
+		if tf.reorder == nil {
+			tf.reorder = &reorderBuffer{}
+		}
+		tf.reorder.window = window
+	}
+}
+
+// Default maximum number of items held by the reorder buffer
+const defaultReorderLimit = 1 << 20
+
+// WithReorderLimit sets the maximum number of items held by the reorder
+// buffer. Past it, the items with the lowest ticks are written before
+// their window has passed, and the writes that arrive below them are late
+// arrivals. The default is 1 << 20 items.
+func WithReorderLimit(maxItems int) TickFileConfig {
+	return func(tf *TickFile) {
+		if tf.reorder == nil {
+			tf.reorder = &reorderBuffer{}
+		}
+		tf.reorder.limit = maxItems
+	}
+}
+
+// WithLateArrival sets the callback called with the writes that arrive
+// after the window of their tick has passed, instead of returning
+// ErrTickOutOfOrder. The deltas are only valid during the call.
+func WithLateArrival(callback func(tick uint64, deltas TickDeltas)) TickFileConfig {
+	return func(tf *TickFile) {
+		if tf.reorder == nil {
+			tf.reorder = &reorderBuffer{}
+		}
+		tf.reorder.late = callback
+	}
+}
+
+type reorderItem struct {
+	tick uint64
+	// Arrival order, to keep the order of the items of the same tick
+	seq  uint64
+	len  int
+	data []byte
+}
+
+type reorderHeap []reorderItem
+
+func (h reorderHeap) Len() int {
+	return len(h)
+}
+
+func (h reorderHeap) Less(i, j int) bool {
+	if h[i].tick == h[j].tick {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h reorderHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *reorderHeap) Push(x interface{}) {
+	*h = append(*h, x.(reorderItem))
+}
+
+func (h *reorderHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+type reorderBuffer struct {
+	window  uint64
+	limit   int
+	late    func(tick uint64, deltas TickDeltas)
+	maxTick uint64
+	items   reorderHeap
+	seq     uint64
+	// Number of items in the buffer
+	count int
+}
+
+// check returns an error if the items of the type can't be buffered
+func (b *reorderBuffer) check(dataType reflect.Type) error {
+	if dataType != nil && dataType.Size() == 0 {
+		return fmt.Errorf("can't reorder items of zero size type %s", dataType)
+	}
+	return nil
+}
+
+func (b *reorderBuffer) write(tf *TickFile, tick uint64, val TickDeltas) error {
+	if val.Len == 0 {
+		return nil
+	}
+	if tick < tf.lastTick {
+		tf.observe().OnOutOfOrder(tf.file.Name(), tick, tf.lastTick)
+		if b.late == nil {
+			return ErrTickOutOfOrder
+		}
+		b.late(tick, val)
+		return nil
+	}
+	size := int(tf.dataType.Size()) * val.Len
+	heap.Push(&b.items, reorderItem{
+		tick: tick,
+		seq:  b.seq,
+		len:  val.Len,
+		data: append([]byte(nil), unsafeBytes(val.Pointer, size)...),
+	})
+	b.seq += 1
+	b.count += val.Len
+	if tick > b.maxTick {
+		b.maxTick = tick
+	}
+
+	// Write the items out of the window, and the lowest items past the
+	// limit
+	limit := b.limit
+	if limit <= 0 {
+		limit = defaultReorderLimit
+	}
+	for len(b.items) > 0 && (b.items[0].tick+b.window <= b.maxTick || b.count > limit) {
+		if err := b.emit(tf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emit writes the item with the lowest tick, it is kept in the buffer if
+// the write fails
+func (b *reorderBuffer) emit(tf *TickFile) error {
+	item := b.items[0]
+	delta := TickDeltas{
+		Pointer: unsafe.Pointer(&item.data[0]),
+		Len:     item.len,
+	}
+	if err := tf.writeDeltas(item.tick, delta); err != nil {
+		return err
+	}
+	heap.Pop(&b.items)
+	b.count -= item.len
+	return nil
+}
+
+func (b *reorderBuffer) drain(tf *TickFile) error {
+	for len(b.items) > 0 {
+		if err := b.emit(tf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
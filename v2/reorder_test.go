@@ -0,0 +1,130 @@
+package gotickfile
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"unsafe"
+)
+
+func TestReorderWindow(t *testing.T) {
+	file, err := fs.Create("reorder.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	var late []uint64
+	tf, err := Create(
+		file,
+		WithDataType(reflect.TypeOf(Data{})),
+		WithReorderWindow(10),
+		WithLateArrival(func(tick uint64, deltas TickDeltas) {
+			late = append(late, tick)
+		}))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+
+	var goldenDeltas []Data
+	for i := 0; i < 1000; i++ {
+		// Jitter of up to 10 ticks
+		tick := uint64(100 + i - rand.Intn(10))
+		delta := Data{Time: tick, Price: uint32(i)}
+		if err := tf.Write(tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+		goldenDeltas = append(goldenDeltas, delta)
+		if i%100 == 0 {
+			if err := tf.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// Too late
+	delta := Data{Time: 50}
+	if err := tf.Write(50, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+		t.Fatalf("error writing: %v", err)
+	}
+	if len(late) != 1 || late[0] != 50 {
+		t.Fatalf("was expecting a late arrival at tick 50, got %v", late)
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.SliceStable(goldenDeltas, func(i, j int) bool {
+		return goldenDeltas[i].Time < goldenDeltas[j].Time
+	})
+	var ticks []uint64
+	for _, d := range goldenDeltas {
+		ticks = append(ticks, d.Time)
+	}
+
+	tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening tickfile: %v", err)
+	}
+	reader, err := tf.GetTickReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReader(t, reader, ticks, goldenDeltas, func(d Data) Data { return d })
+}
+
+func TestReorderLimit(t *testing.T) {
+	var late []uint64
+	tf, err := CreateInMemory(
+		WithDataType(reflect.TypeOf(Data{})),
+		WithReorderWindow(1000),
+		WithReorderLimit(10),
+		WithLateArrival(func(tick uint64, deltas TickDeltas) {
+			late = append(late, tick)
+		}))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	// A burst within the window
+	var ticks []uint64
+	var goldenDeltas []Data
+	for i := 0; i < 100; i++ {
+		delta := Data{Time: uint64(100 + i), Price: uint32(i)}
+		if err := tf.Write(delta.Time, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+		if len(tf.reorder.items) > 10 {
+			t.Fatalf("got %d items in the reorder buffer", len(tf.reorder.items))
+		}
+		ticks = append(ticks, delta.Time)
+		goldenDeltas = append(goldenDeltas, delta)
+	}
+	// Below the items written past the limit
+	delta := Data{Time: 150}
+	if err := tf.Write(150, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+		t.Fatalf("error writing: %v", err)
+	}
+	if len(late) != 1 || late[0] != 150 {
+		t.Fatalf("was expecting a late arrival at tick 150, got %v", late)
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := tf.GetTickReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReader(t, reader, ticks, goldenDeltas, func(d Data) Data { return d })
+}
+
+func TestReorderZeroSize(t *testing.T) {
+	typ := reflect.TypeOf(struct{}{})
+	if _, err := CreateInMemory(WithDataType(typ), WithReorderWindow(10)); err == nil {
+		t.Fatalf("was expecting an error creating a reordered file of %s", typ)
+	}
+	file, err := fs.Create("reorder_zero.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	if _, err := OpenWrite(file, typ, WithReorderWindow(10)); err == nil {
+		t.Fatalf("was expecting an error opening a reordered file of %s", typ)
+	}
+}
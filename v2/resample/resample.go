@@ -0,0 +1,188 @@
+package resample
+
+import (
+	"fmt"
+	"github.com/melaurent/gotickfile/v2"
+	"github.com/melaurent/kafero"
+	"io"
+	"math"
+	"reflect"
+	"unsafe"
+)
+
+// Bar summarizes the items of an interval of ticks. It is written at the
+// first tick of the interval.
+type Bar struct {
+	// Prices of the first, highest, lowest and last items of the
+	// interval, all read from the price field
+	Open  float64
+	High  float64
+	Low   float64
+	Close float64
+	// Sum of the volume field of the items, 0 without WithVolumeField
+	Volume float64
+	// Number of items of the interval
+	Count uint64
+}
+
+type Config func(r *resampler)
+
+// WithVolumeField sets the field summed in the volume of the bars. Without
+// it, the volume of the bars is 0, no field is taken as the volume by
+// default.
+func WithVolumeField(name string) Config {
+	return func(r *resampler) {
+		r.volumeField = name
+	}
+}
+
+// WithOutputConfigs adds configs used to create the file of the bars, such
+// as WithTags or WithColumnarLayout.
+func WithOutputConfigs(configs ...gotickfile.TickFileConfig) Config {
+	return func(r *resampler) {
+		r.configs = append(r.configs, configs...)
+	}
+}
+
+type resampler struct {
+	volumeField string
+	configs     []gotickfile.TickFileConfig
+}
+
+// field reads a numeric field of the items as a float64
+type field struct {
+	offset uintptr
+	typ    uint8
+}
+
+func newField(info *gotickfile.ItemSection, name string) (field, error) {
+	for _, f := range info.Fields {
+		if f.Name != name {
+			continue
+		}
+		switch f.Type {
+		case gotickfile.INT8, gotickfile.INT16, gotickfile.INT32, gotickfile.INT64,
+			gotickfile.UINT8, gotickfile.UINT16, gotickfile.UINT32, gotickfile.UINT64,
+			gotickfile.FLOAT32, gotickfile.FLOAT64:
+			return field{offset: uintptr(f.Offset), typ: f.Type}, nil
+		default:
+			return field{}, fmt.Errorf("field %s is not numeric", name)
+		}
+	}
+	return field{}, fmt.Errorf("unknown field %s", name)
+}
+
+func (f field) value(item unsafe.Pointer) float64 {
+	ptr := unsafe.Pointer(uintptr(item) + f.offset)
+	switch f.typ {
+	case gotickfile.INT8:
+		return float64(*(*int8)(ptr))
+	case gotickfile.INT16:
+		return float64(*(*int16)(ptr))
+	case gotickfile.INT32:
+		return float64(*(*int32)(ptr))
+	case gotickfile.INT64:
+		return float64(*(*int64)(ptr))
+	case gotickfile.UINT8:
+		return float64(*(*uint8)(ptr))
+	case gotickfile.UINT16:
+		return float64(*(*uint16)(ptr))
+	case gotickfile.UINT32:
+		return float64(*(*uint32)(ptr))
+	case gotickfile.UINT64:
+		return float64(*(*uint64)(ptr))
+	case gotickfile.FLOAT32:
+		return float64(*(*float32)(ptr))
+	default:
+		return *(*float64)(ptr)
+	}
+}
+
+// Resample reads the items of reader and writes to dst a bar of the price
+// field for each interval of interval ticks, starting at tick 0. The open,
+// high, low and close of the bars are all read from the price field, and
+// their volume from the field set with WithVolumeField, if any. Intervals
+// without items have no bar. The fields are named as in the item section of
+// the file, array elements as Name.0, Name.1...
+func Resample(dst kafero.File, reader *gotickfile.CTickReader, interval uint64, priceField string, configs ...Config) (err error) {
+	r := &resampler{}
+	for _, config := range configs {
+		config(r)
+	}
+	if interval == 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	price, err := newField(reader.ItemSection(), priceField)
+	if err != nil {
+		return err
+	}
+	var volume *field
+	if r.volumeField != "" {
+		f, err := newField(reader.ItemSection(), r.volumeField)
+		if err != nil {
+			return err
+		}
+		volume = &f
+	}
+
+	tf, err := gotickfile.Create(dst, append([]gotickfile.TickFileConfig{
+		gotickfile.WithDataType(reflect.TypeOf(Bar{})),
+	}, r.configs...)...)
+	if err != nil {
+		return fmt.Errorf("error creating bar file: %w", err)
+	}
+	// The bars written before an error are kept
+	defer func() {
+		if cerr := tf.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("error closing bar file: %w", cerr)
+		}
+	}()
+
+	size := reader.DeltaType().Size()
+	var bar Bar
+	var barTick uint64
+	write := func() error {
+		if bar.Count == 0 {
+			return nil
+		}
+		return tf.Write(barTick, gotickfile.TickDeltas{Pointer: unsafe.Pointer(&bar), Len: 1})
+	}
+	for {
+		tick, deltas, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading ticks: %w", err)
+		}
+		if start := tick - tick%interval; bar.Count == 0 || start != barTick {
+			if err := write(); err != nil {
+				return fmt.Errorf("error writing bar: %w", err)
+			}
+			bar = Bar{High: math.Inf(-1), Low: math.Inf(1)}
+			barTick = start
+		}
+		for i := 0; i < deltas.Len; i++ {
+			item := unsafe.Pointer(uintptr(deltas.Pointer) + uintptr(i)*size)
+			p := price.value(item)
+			if bar.Count == 0 {
+				bar.Open = p
+			}
+			if p > bar.High {
+				bar.High = p
+			}
+			if p < bar.Low {
+				bar.Low = p
+			}
+			bar.Close = p
+			if volume != nil {
+				bar.Volume += volume.value(item)
+			}
+			bar.Count += 1
+		}
+	}
+	if err := write(); err != nil {
+		return fmt.Errorf("error writing bar: %w", err)
+	}
+	return nil
+}
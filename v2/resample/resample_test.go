@@ -0,0 +1,185 @@
+package resample
+
+import (
+	"github.com/melaurent/gotickfile/v2"
+	"github.com/melaurent/gotickfile/v2/compress"
+	"github.com/melaurent/kafero"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+type Trade struct {
+	Price float32
+	Size  uint64
+	Side  [2]int8
+}
+
+func TestResample(t *testing.T) {
+	src, err := gotickfile.CreateInMemory(gotickfile.WithDataType(reflect.TypeOf(Trade{})))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	const interval = 60
+	var golden []Bar
+	var goldenTicks []uint64
+	var tick uint64 = 1000
+	for i := 0; i < 5000; i++ {
+		switch rand.Intn(4) {
+		case 0:
+			tick += uint64(rand.Intn(5 * interval))
+		case 1:
+			tick += uint64(rand.Intn(10))
+		}
+		trades := make([]Trade, 1+rand.Intn(3))
+		for j := range trades {
+			trades[j] = Trade{Price: float32(rand.Intn(1000)) / 4, Size: uint64(rand.Intn(100)), Side: [2]int8{int8(i % 2), 0}}
+			p := float64(trades[j].Price)
+			start := tick - tick%interval
+			if n := len(goldenTicks); n == 0 || goldenTicks[n-1] != start {
+				goldenTicks = append(goldenTicks, start)
+				golden = append(golden, Bar{Open: p, High: p, Low: p})
+			}
+			bar := &golden[len(golden)-1]
+			bar.High = math.Max(bar.High, p)
+			bar.Low = math.Min(bar.Low, p)
+			bar.Close = p
+			bar.Volume += float64(trades[j].Size)
+			bar.Count += 1
+		}
+		if err := src.Write(tick, gotickfile.TickDeltas{Pointer: unsafe.Pointer(&trades[0]), Len: len(trades)}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+	}
+	if err := src.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := kafero.NewMemMapFs()
+	dst, err := fs.Create("bars.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	reader, err := src.GetTickReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Resample(dst, reader, interval, "Price", WithVolumeField("Size")); err != nil {
+		t.Fatalf("error resampling: %v", err)
+	}
+
+	tf, err := gotickfile.OpenRead(dst, reflect.TypeOf(Bar{}))
+	if err != nil {
+		t.Fatalf("error opening bars: %v", err)
+	}
+	if tf.ItemCount() != len(golden) {
+		t.Fatalf("got %d bars, was expecting %d", tf.ItemCount(), len(golden))
+	}
+	for i := range golden {
+		tick, val, err := tf.ReadItem(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tick != goldenTicks[i] || *val.(*Bar) != golden[i] {
+			t.Fatalf("got different bar at %d: %d %v, %d %v", i, tick, *val.(*Bar), goldenTicks[i], golden[i])
+		}
+	}
+
+	// The volume is 0 without a volume field
+	reader, err = src.GetTickReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err = fs.Create("novolume.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	if err := Resample(dst, reader, interval, "Price"); err != nil {
+		t.Fatalf("error resampling: %v", err)
+	}
+	tf, err = gotickfile.OpenRead(dst, reflect.TypeOf(Bar{}))
+	if err != nil {
+		t.Fatalf("error opening bars: %v", err)
+	}
+	for i := range golden {
+		_, val, err := tf.ReadItem(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bar := golden[i]
+		bar.Volume = 0
+		if *val.(*Bar) != bar {
+			t.Fatalf("got different bar at %d: %v, %v", i, *val.(*Bar), bar)
+		}
+	}
+
+	// Array elements and unknown fields
+	reader, err = src.GetTickReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err = fs.Create("side.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	if err := Resample(dst, reader, interval, "Side.0"); err != nil {
+		t.Fatalf("error resampling: %v", err)
+	}
+	if err := Resample(dst, reader, interval, "Unknown"); err == nil {
+		t.Fatalf("was expecting an error for an unknown field")
+	}
+	if err := Resample(dst, reader, 0, "Price"); err == nil {
+		t.Fatalf("was expecting an error for a zero interval")
+	}
+}
+
+func TestResampleReadError(t *testing.T) {
+	info, err := gotickfile.TypeToItemSection(reflect.TypeOf(Trade{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := compress.NewBBuffer(nil, 0)
+	trade := Trade{Price: 0, Size: 1}
+	w := gotickfile.NewCTickWriter(buf, info, 0, unsafe.Pointer(&trade))
+	for i := 1; i < 1000; i++ {
+		trade.Price = float32(i)
+		w.Write(buf, uint64(i), unsafe.Pointer(&trade))
+	}
+	w.Close(buf)
+	// Reader of the first half of the stream
+	data := buf.Bytes()
+	br := compress.NewBitReader(compress.NewBBuffer(data[:len(data)/2], 8))
+	reader, err := gotickfile.NewCTickReader(info, reflect.TypeOf(Trade{}), br)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := kafero.NewMemMapFs()
+	dst, err := fs.Create("bars.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	if err := Resample(dst, reader, 10, "Price"); err == nil {
+		t.Fatalf("was expecting a read error")
+	}
+	// The bars before the error were flushed
+	tf, err := gotickfile.OpenRead(dst, reflect.TypeOf(Bar{}))
+	if err != nil {
+		t.Fatalf("error opening bars: %v", err)
+	}
+	if tf.ItemCount() == 0 {
+		t.Fatalf("was expecting bars before the error")
+	}
+	for i := 0; i < tf.ItemCount(); i++ {
+		tick, val, err := tf.ReadItem(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bar := *val.(*Bar)
+		if tick != uint64(10*i) || bar.Open != float64(10*i) || bar.Count != 10 {
+			t.Fatalf("got different bar at %d: %d %v", i, tick, bar)
+		}
+	}
+}
@@ -116,6 +116,168 @@ func (is *ItemSection) Size() int64 {
 	return size
 }
 
+type BlockSection struct {
+	Layout      uint8
+	BlockSize   uint32
+	Compression uint8
+}
+
+func (bs *BlockSection) Read(r io.Reader, order binary.ByteOrder) error {
+	if err := binary.Read(r, order, &bs.Layout); err != nil {
+		return err
+	}
+	if err := binary.Read(r, order, &bs.BlockSize); err != nil {
+		return err
+	}
+	if err := binary.Read(r, order, &bs.Compression); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (bs *BlockSection) Write(w io.Writer, order binary.ByteOrder) error {
+	if err := binary.Write(w, order, bs.Layout); err != nil {
+		return err
+	}
+	if err := binary.Write(w, order, bs.BlockSize); err != nil {
+		return err
+	}
+	if err := binary.Write(w, order, bs.Compression); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (bs *BlockSection) Size() int64 {
+	var size int64 = 0
+	// Layout
+	size += 1
+	// BlockSize
+	size += 4
+	// Compression
+	size += 1
+	return size
+}
+
+// CheckpointSection holds the state of the writer after the first DataBits
+// bits of the data, so a file can be opened by only decoding the data
+// written after them. It has a fixed size and is rewritten in place.
+type CheckpointSection struct {
+	DataBits  int64
+	LastTick  uint64
+	ItemCount uint64
+	// Tick compressor state followed by the field compressors states
+	State []byte
+}
+
+func (cs *CheckpointSection) Read(r io.Reader, order binary.ByteOrder) error {
+	if err := binary.Read(r, order, &cs.DataBits); err != nil {
+		return err
+	}
+	if err := binary.Read(r, order, &cs.LastTick); err != nil {
+		return err
+	}
+	if err := binary.Read(r, order, &cs.ItemCount); err != nil {
+		return err
+	}
+	var stateSize uint32
+	if err := binary.Read(r, order, &stateSize); err != nil {
+		return err
+	}
+	cs.State = make([]byte, stateSize)
+	if _, err := io.ReadFull(r, cs.State); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cs *CheckpointSection) Write(w io.Writer, order binary.ByteOrder) error {
+	if err := binary.Write(w, order, cs.DataBits); err != nil {
+		return err
+	}
+	if err := binary.Write(w, order, cs.LastTick); err != nil {
+		return err
+	}
+	if err := binary.Write(w, order, cs.ItemCount); err != nil {
+		return err
+	}
+	if err := binary.Write(w, order, uint32(len(cs.State))); err != nil {
+		return err
+	}
+	if _, err := w.Write(cs.State); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cs *CheckpointSection) Size() int64 {
+	var size int64 = 0
+	// DataBits
+	size += 8
+	// LastTick
+	size += 8
+	// ItemCount
+	size += 8
+	// State
+	size += 4 + int64(len(cs.State))
+	return size
+}
+
+// ItemIndexSection locates the entries of the item index, written after
+// the data when the file is closed. It has a fixed size and is rewritten in
+// place. A zero DataEnd means that the data runs to the end of the file.
+type ItemIndexSection struct {
+	DataEnd    int64
+	ItemCount  uint64
+	LastTick   uint64
+	EntryCount uint32
+}
+
+func (is *ItemIndexSection) Read(r io.Reader, order binary.ByteOrder) error {
+	if err := binary.Read(r, order, &is.DataEnd); err != nil {
+		return err
+	}
+	if err := binary.Read(r, order, &is.ItemCount); err != nil {
+		return err
+	}
+	if err := binary.Read(r, order, &is.LastTick); err != nil {
+		return err
+	}
+	if err := binary.Read(r, order, &is.EntryCount); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (is *ItemIndexSection) Write(w io.Writer, order binary.ByteOrder) error {
+	if err := binary.Write(w, order, is.DataEnd); err != nil {
+		return err
+	}
+	if err := binary.Write(w, order, is.ItemCount); err != nil {
+		return err
+	}
+	if err := binary.Write(w, order, is.LastTick); err != nil {
+		return err
+	}
+	if err := binary.Write(w, order, is.EntryCount); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (is *ItemIndexSection) Size() int64 {
+	var size int64 = 0
+	// DataEnd
+	size += 8
+	// ItemCount
+	size += 8
+	// LastTick
+	size += 8
+	// EntryCount
+	size += 4
+	return size
+}
+
 type NameValueSection struct {
 	NameValues map[string]interface{}
 }
@@ -0,0 +1,394 @@
+package gotickfile
+
+import (
+	"context"
+	"fmt"
+	"github.com/melaurent/kafero"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HOURLY_PARTITION = time.Hour
+	DAILY_PARTITION  = 24 * time.Hour
+)
+
+const storeFileExt = ".tick"
+
+type StoreConfig func(s *Store)
+
+// WithPartition sets the period covered by each file of a key,
+// DAILY_PARTITION or HOURLY_PARTITION. Partitions are aligned on UTC.
+func WithPartition(partition time.Duration) StoreConfig {
+	return func(s *Store) {
+		switch partition {
+		case HOURLY_PARTITION:
+			s.layout = "2006010215"
+		case DAILY_PARTITION:
+			s.layout = "20060102"
+		default:
+			panic(fmt.Sprintf("unsupported partition: %s", partition))
+		}
+		s.partition = partition
+	}
+}
+
+// WithTickUnit sets the duration of a tick, ticks being counted from the
+// unix epoch. The default is a millisecond.
+func WithTickUnit(unit time.Duration) StoreConfig {
+	return func(s *Store) {
+		if unit <= 0 {
+			panic(fmt.Sprintf("invalid tick unit: %s", unit))
+		}
+		s.unit = unit
+	}
+}
+
+// WithFileConfigs sets the configs used to create the files of the store.
+// The data type of the store is always used.
+func WithFileConfigs(configs ...TickFileConfig) StoreConfig {
+	return func(s *Store) {
+		s.configs = append(s.configs, configs...)
+	}
+}
+
+type Partition struct {
+	Path string
+	// The partition contains the ticks in [From, To)
+	From uint64
+	To   uint64
+}
+
+type storeWriter struct {
+	tf        *TickFile
+	partition Partition
+}
+
+// Store keeps the ticks of each key in a directory of files, one file per
+// partition, named after the partition start.
+type Store struct {
+	sync.Mutex
+	fs        kafero.Fs
+	root      string
+	dataType  reflect.Type
+	partition time.Duration
+	layout    string
+	unit      time.Duration
+	configs   []TickFileConfig
+	writers   map[string]*storeWriter
+}
+
+func NewStore(fs kafero.Fs, root string, dataType reflect.Type, configs ...StoreConfig) *Store {
+	s := &Store{
+		fs:       fs,
+		root:     root,
+		dataType: dataType,
+		unit:     time.Millisecond,
+		writers:  make(map[string]*storeWriter),
+	}
+	WithPartition(DAILY_PARTITION)(s)
+	for _, config := range configs {
+		config(s)
+	}
+	return s
+}
+
+func (s *Store) partitionOf(key string, tick uint64) Partition {
+	t := time.Unix(0, int64(tick)*int64(s.unit)).UTC().Truncate(s.partition)
+	return s.newPartition(key, t)
+}
+
+func (s *Store) newPartition(key string, t time.Time) Partition {
+	return Partition{
+		Path: path.Join(s.root, key, t.Format(s.layout)+storeFileExt),
+		From: uint64(t.UnixNano() / int64(s.unit)),
+		To:   uint64(t.Add(s.partition).UnixNano() / int64(s.unit)),
+	}
+}
+
+// checkKey returns ErrInvalidKey if the key is not the name of a directory
+// in the root of the store
+func checkKey(key string) error {
+	if key == "" || key == "." || strings.Contains(key, "..") || path.Clean(key) != key ||
+		strings.ContainsRune(key, '/') || strings.ContainsRune(key, os.PathSeparator) {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+// List returns the partitions of the key, sorted by time.
+func (s *Store) List(key string) ([]Partition, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	dir, err := s.fs.Open(path.Join(s.root, key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error opening key directory: %w", err)
+	}
+	defer dir.Close()
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return nil, fmt.Errorf("error listing key directory: %w", err)
+	}
+	var partitions []Partition
+	for _, name := range names {
+		if !strings.HasSuffix(name, storeFileExt) {
+			continue
+		}
+		t, err := time.Parse(s.layout, strings.TrimSuffix(name, storeFileExt))
+		if err != nil {
+			// Not a partition of this store
+			continue
+		}
+		partitions = append(partitions, s.newPartition(key, t))
+	}
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].From < partitions[j].From
+	})
+	return partitions, nil
+}
+
+// Append writes the deltas to the partition of the tick, closing the
+// previous partition of the key when the tick crosses a boundary. The tags
+// of the previous partition are carried to the new one.
+func (s *Store) Append(key string, tick uint64, deltas TickDeltas) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	w, ok := s.writers[key]
+	if ok && tick >= w.partition.To {
+		if err := s.closeWriter(key, w); err != nil {
+			return err
+		}
+		ok = false
+	}
+	if !ok {
+		var err error
+		w, err = s.openWriter(key, tick)
+		if err != nil {
+			return err
+		}
+		s.writers[key] = w
+	}
+	if tick < w.partition.From {
+		return ErrTickOutOfOrder
+	}
+	return w.tf.Write(tick, deltas)
+}
+
+func (s *Store) openWriter(key string, tick uint64) (*storeWriter, error) {
+	partitions, err := s.List(key)
+	if err != nil {
+		return nil, err
+	}
+	p := s.partitionOf(key, tick)
+	var tags map[string]string
+	if n := len(partitions); n > 0 {
+		last := partitions[n-1]
+		if last.From > p.From {
+			return nil, ErrTickOutOfOrder
+		}
+		if last.From == p.From {
+			file, err := s.fs.OpenFile(p.Path, os.O_RDWR, 0644)
+			if err != nil {
+				return nil, fmt.Errorf("error opening partition: %w", err)
+			}
+			// The writer options, such as the observer, apply to the
+			// partition being continued
+			tf, err := OpenWrite(file, s.dataType, s.configs...)
+			if err != nil {
+				_ = file.Close()
+				return nil, fmt.Errorf("error opening partition: %w", err)
+			}
+			return &storeWriter{tf: tf, partition: p}, nil
+		}
+		tags, err = s.partitionTags(last)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.fs.MkdirAll(path.Dir(p.Path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating key directory: %w", err)
+	}
+	file, err := s.fs.Create(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating partition: %w", err)
+	}
+	configs := append([]TickFileConfig{WithDataType(s.dataType)}, s.configs...)
+	if tags != nil {
+		configs = append(configs, WithTags(tags))
+	}
+	tf, err := Create(file, configs...)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("error creating partition: %w", err)
+	}
+	return &storeWriter{tf: tf, partition: p}, nil
+}
+
+func (s *Store) partitionTags(p Partition) (map[string]string, error) {
+	file, err := s.fs.Open(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening partition: %w", err)
+	}
+	defer file.Close()
+	tf, err := OpenHeader(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading partition header: %w", err)
+	}
+	return tf.GetTags(), nil
+}
+
+func (s *Store) closeWriter(key string, w *storeWriter) error {
+	delete(s.writers, key)
+	if err := w.tf.Close(); err != nil {
+		_ = w.tf.GetFile().Close()
+		return fmt.Errorf("error closing partition: %w", err)
+	}
+	return w.tf.GetFile().Close()
+}
+
+// Flush flushes the partitions being written.
+func (s *Store) Flush() error {
+	s.Lock()
+	defer s.Unlock()
+	for _, w := range s.writers {
+		if err := w.tf.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the partitions being written.
+func (s *Store) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	var err error
+	for key, w := range s.writers {
+		if cerr := s.closeWriter(key, w); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Reader returns a reader over the ticks of the key in [from, to), chaining
+// the partitions. Only the flushed content of the partitions is read.
+func (s *Store) Reader(key string, from, to uint64, configs ...TickReaderConfig) (*StoreReader, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	partitions, err := s.List(key)
+	if err != nil {
+		return nil, err
+	}
+	r := &StoreReader{
+		store:   s,
+		from:    from,
+		to:      to,
+		configs: configs,
+	}
+	for _, p := range partitions {
+		if p.To > from && p.From < to {
+			r.partitions = append(r.partitions, p)
+		}
+	}
+	return r, nil
+}
+
+type StoreReader struct {
+	store      *Store
+	from       uint64
+	to         uint64
+	configs    []TickReaderConfig
+	partitions []Partition
+	file       kafero.File
+	tf         *TickFile
+	reader     *CTickReader
+	// Context of the current NextContext call
+	ctx context.Context
+}
+
+func (r *StoreReader) Next() (uint64, TickDeltas, error) {
+	for {
+		if r.reader == nil {
+			if len(r.partitions) == 0 {
+				return 0, TickDeltas{}, io.EOF
+			}
+			if err := r.open(r.partitions[0]); err != nil {
+				return 0, TickDeltas{}, err
+			}
+			r.partitions = r.partitions[1:]
+		}
+		ctx := r.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		tick, deltas, err := r.reader.NextContext(ctx)
+		if err == io.EOF {
+			if err := r.Close(); err != nil {
+				return 0, TickDeltas{}, err
+			}
+			continue
+		}
+		return tick, deltas, err
+	}
+}
+
+func (r *StoreReader) open(p Partition) error {
+	file, err := r.store.fs.Open(p.Path)
+	if err != nil {
+		return fmt.Errorf("error opening partition: %w", err)
+	}
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	tf, err := OpenReadContext(ctx, file, r.store.dataType)
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("error opening partition %s: %w", p.Path, err)
+	}
+	configs := append([]TickReaderConfig{WithTickRange(r.from, r.to)}, r.configs...)
+	reader, err := tf.GetTickReader(configs...)
+	if err != nil {
+		_ = tf.Close()
+		_ = file.Close()
+		return err
+	}
+	r.file = file
+	r.tf = tf
+	r.reader = reader
+	return nil
+}
+
+// Close closes the partition being read.
+func (r *StoreReader) Close() error {
+	r.reader = nil
+	if r.file == nil {
+		return nil
+	}
+	file := r.file
+	tf := r.tf
+	r.file = nil
+	r.tf = nil
+	if err := tf.Close(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
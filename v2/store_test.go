@@ -0,0 +1,152 @@
+package gotickfile
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestStore(t *testing.T) {
+	start := uint64(time.Date(2021, 3, 1, 22, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond))
+	store := NewStore(fs, "store", reflect.TypeOf(Data{}),
+		WithPartition(HOURLY_PARTITION),
+		WithFileConfigs(WithTags(map[string]string{"exchange": "NYSE"})))
+
+	var ticks []uint64
+	var goldenDeltas []Data
+	// 5 hours of data, a tick every minute
+	for i := 0; i < 300; i++ {
+		tick := start + uint64(i)*uint64(time.Minute/time.Millisecond)
+		delta := Data{Time: tick, Price: uint32(i)}
+		if err := store.Append("acme", tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+			t.Fatalf("error appending: %v", err)
+		}
+		ticks = append(ticks, tick)
+		goldenDeltas = append(goldenDeltas, delta)
+	}
+	if err := store.Append("acme", start, TickDeltas{Pointer: unsafe.Pointer(&Data{}), Len: 1}); err != ErrTickOutOfOrder {
+		t.Fatalf("was expecting out of order error, got %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	partitions, err := store.List("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(partitions) != 5 {
+		t.Fatalf("was expecting 5 partitions, got %d", len(partitions))
+	}
+	if partitions[2].Path != "store/acme/2021030200.tick" || partitions[2].From != ticks[120] {
+		t.Fatalf("got unexpected partition: %v", partitions[2])
+	}
+
+	// Reopen the store and continue the last partition
+	store = NewStore(fs, "store", reflect.TypeOf(Data{}), WithPartition(HOURLY_PARTITION))
+	for i := 300; i < 400; i++ {
+		tick := start + uint64(i)*uint64(time.Minute/time.Millisecond)
+		delta := Data{Time: tick, Price: uint32(i)}
+		if err := store.Append("acme", tick, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+			t.Fatalf("error appending: %v", err)
+		}
+		ticks = append(ticks, tick)
+		goldenDeltas = append(goldenDeltas, delta)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	partitions, err = store.List("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(partitions) != 7 {
+		t.Fatalf("was expecting 7 partitions, got %d", len(partitions))
+	}
+	tags, err := store.partitionTags(partitions[6])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags["exchange"] != "NYSE" {
+		t.Fatalf("tags were not carried to the new partition: %v", tags)
+	}
+
+	// Read across partitions
+	reader, err := store.Reader("acme", ticks[50], ticks[350])
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := 50
+	tick, deltas, err := reader.Next()
+	for err == nil {
+		if tick != ticks[i] || *(*Data)(deltas.Pointer) != goldenDeltas[i] {
+			t.Fatalf("got a different read than expected at %d", i)
+		}
+		i += 1
+		tick, deltas, err = reader.Next()
+	}
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+	if i != 350 {
+		t.Fatalf("was expecting to read up to item 350, got %d", i)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RemoveAll("store"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreReopenObserver(t *testing.T) {
+	start := uint64(time.Date(2021, 3, 1, 22, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond))
+	observer := NewCounterObserver()
+	for i := 0; i < 2; i++ {
+		// The second store continues the partition of the first one
+		store := NewStore(fs, "store", reflect.TypeOf(Data{}), WithFileConfigs(WithObserver(observer)))
+		delta := Data{Time: start + uint64(i)}
+		if err := store.Append("acme", delta.Time, TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+			t.Fatalf("error appending: %v", err)
+		}
+		if err := store.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if n := observer.Counters()["writes_total"]; n != int64(i+1) {
+			t.Fatalf("was expecting %d writes to be observed, got %d", i+1, n)
+		}
+	}
+	partitions, err := NewStore(fs, "store", reflect.TypeOf(Data{})).List("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(partitions) != 1 {
+		t.Fatalf("was expecting the partition to be continued, got %d partitions", len(partitions))
+	}
+	if err := fs.RemoveAll("store"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreInvalidKey(t *testing.T) {
+	store := NewStore(fs, "store", reflect.TypeOf(Data{}))
+	for _, key := range []string{"", ".", "..", "../acme", "acme/..", "a..b", "acme/nyse", "/acme", "acme/", "./acme"} {
+		if err := store.Append(key, 0, TickDeltas{Pointer: unsafe.Pointer(&Data{}), Len: 1}); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("%q: was expecting an invalid key error when appending, got %v", key, err)
+		}
+		if _, err := store.List(key); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("%q: was expecting an invalid key error when listing, got %v", key, err)
+		}
+		if _, err := store.Reader(key, 0, 1); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("%q: was expecting an invalid key error when reading, got %v", key, err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
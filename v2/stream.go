@@ -0,0 +1,126 @@
+package gotickfile
+
+import (
+	"fmt"
+	"github.com/melaurent/gotickfile/v2/compress"
+	"io"
+	"io/ioutil"
+	"reflect"
+)
+
+// Size of the rolling buffer of a stream reader
+const streamBufferSize = 1 << 16
+
+// countingReader counts the bytes read
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// StreamReader decodes a tick file from a reader that can't seek, like a
+// pipe or a HTTP body, with a bounded memory. Only the stream layout is
+// supported.
+type StreamReader struct {
+	tf     *TickFile
+	br     *compress.BitReader
+	reader *CTickReader
+}
+
+// NewStreamReader reads the header of the file from r and returns a reader
+// decoding its ticks as they are read from r.
+func NewStreamReader(r io.Reader, typ reflect.Type, configs ...TickReaderConfig) (*StreamReader, error) {
+	tf := &TickFile{
+		dataType: typ,
+	}
+	cr := &countingReader{r: r}
+	if err := tf.readHeaderFrom(cr); err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+	if err := tf.checkDataType(); err != nil {
+		return nil, fmt.Errorf("error checking data type: %w", err)
+	}
+	if tf.itemSection == nil {
+		return nil, fmt.Errorf("this file has no item section")
+	}
+	if tf.blockSection != nil {
+		return nil, fmt.Errorf("stream reader not supported with a columnar layout")
+	}
+	if cr.n > tf.header.ItemStart {
+		return nil, fmt.Errorf("header is larger than the item start")
+	}
+	// Skip to the first item
+	if _, err := io.CopyN(ioutil.Discard, cr, tf.header.ItemStart-cr.n); err != nil {
+		return nil, fmt.Errorf("error skipping to first item: %w", err)
+	}
+
+	if is := tf.itemIndexSection; is != nil && is.DataEnd != 0 {
+		// Stop before the item index written after the data
+		r = io.LimitReader(r, is.DataEnd-tf.header.ItemStart)
+	}
+	br := compress.NewStreamBitReader(r, streamBufferSize)
+	reader, err := NewCTickReader(tf.itemSection, tf.dataType, br)
+	if err != nil {
+		return nil, err
+	}
+	reader.swaps = tf.byteSwaps()
+	for _, config := range configs {
+		config(reader)
+	}
+	if err := reader.setupFilters(); err != nil {
+		return nil, err
+	}
+	if _, err := reader.columns(); err != nil {
+		return nil, err
+	}
+	return &StreamReader{
+		tf:     tf,
+		br:     br,
+		reader: reader,
+	}, nil
+}
+
+// Next returns the next tick and its deltas, io.EOF at the end of the
+// stream, or the error of the underlying reader.
+func (r *StreamReader) Next() (uint64, TickDeltas, error) {
+	tick, deltas, err := r.reader.Next()
+	if err != nil && err != io.EOF {
+		if serr := r.br.Err(); serr != nil {
+			return tick, deltas, serr
+		}
+	}
+	return tick, deltas, err
+}
+
+// NextInto is like Next, but copies the deltas to dst, see
+// CTickReader.NextInto.
+func (r *StreamReader) NextInto(dst interface{}) (uint64, error) {
+	tick, err := r.reader.NextInto(dst)
+	if err != nil && err != io.EOF {
+		if serr := r.br.Err(); serr != nil {
+			return tick, serr
+		}
+	}
+	return tick, err
+}
+
+func (r *StreamReader) DeltaType() reflect.Type {
+	return r.reader.DeltaType()
+}
+
+func (r *StreamReader) GetNameValues() map[string]interface{} {
+	return r.tf.GetNameValues()
+}
+
+func (r *StreamReader) GetTags() map[string]string {
+	return r.tf.GetTags()
+}
+
+func (r *StreamReader) GetContentDescription() *string {
+	return r.tf.GetContentDescription()
+}
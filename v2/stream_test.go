@@ -0,0 +1,118 @@
+package gotickfile
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"testing/iotest"
+	"unsafe"
+)
+
+type failingReader struct {
+	err error
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func streamFileBytes(t *testing.T, n int) []byte {
+	file, err := fs.Create("stream.tick")
+	if err != nil {
+		t.Fatalf("error creating file")
+	}
+	tf, err := Create(file, WithDataType(reflect.TypeOf(Data{})), WithTags(map[string]string{"venue": "nyse"}))
+	if err != nil {
+		t.Fatalf("error creating tickfile: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		delta := Data{Time: uint64(i), Price: uint32(i * 7919), Volume: uint64(i % 13)}
+		if err := tf.Write(uint64(i/3), TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestStreamReader(t *testing.T) {
+	N := 30000
+	data := streamFileBytes(t, N)
+
+	readers := map[string]io.Reader{
+		"bytes":    bytes.NewReader(data),
+		"one byte": iotest.OneByteReader(bytes.NewReader(data)),
+		"half":     iotest.HalfReader(bytes.NewReader(data)),
+	}
+	for name, r := range readers {
+		sr, err := NewStreamReader(r, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("%s: error opening stream: %v", name, err)
+		}
+		if sr.GetTags()["venue"] != "nyse" {
+			t.Fatalf("%s: got different tags: %v", name, sr.GetTags())
+		}
+		count := 0
+		for {
+			tick, deltas, err := sr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			for i := 0; i < deltas.Len; i++ {
+				d := *(*Data)(unsafe.Pointer(uintptr(deltas.Pointer) + uintptr(i)*unsafe.Sizeof(Data{})))
+				if tick != uint64(count/3) || d.Time != uint64(count) || d.Price != uint32(count*7919) {
+					t.Fatalf("%s: got different item at %d: %d %d", name, count, tick, d.Time)
+				}
+				count += 1
+			}
+		}
+		if count != N {
+			t.Fatalf("%s: got %d items, was expecting %d", name, count, N)
+		}
+	}
+}
+
+func TestStreamReaderErrors(t *testing.T) {
+	data := streamFileBytes(t, 1000)
+
+	// The error of the underlying reader is returned
+	errRead := errors.New("connection reset")
+	r := io.MultiReader(bytes.NewReader(data[:len(data)/2]), failingReader{err: errRead})
+	sr, err := NewStreamReader(r, reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening stream: %v", err)
+	}
+	for err == nil {
+		_, _, err = sr.Next()
+	}
+	if err != errRead {
+		t.Fatalf("was expecting read error, got %v", err)
+	}
+
+	// A truncated stream has no end value
+	sr, err = NewStreamReader(bytes.NewReader(data[:len(data)-1]), reflect.TypeOf(Data{}))
+	if err != nil {
+		t.Fatalf("error opening stream: %v", err)
+	}
+	for err == nil {
+		_, _, err = sr.Next()
+	}
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("was expecting unexpected EOF, got %v", err)
+	}
+}
@@ -1,58 +1,150 @@
 package gotickfile
 
 import (
-	"bytes"
 	"fmt"
+	"io"
 	"reflect"
+	"sort"
 	"unsafe"
 )
 
+// TickBuffer is an in-memory series of items and their ticks, in tick
+// order. The items are kept in a slice of the data type.
 type TickBuffer struct {
 	dataType reflect.Type
-	buff     *bytes.Buffer
-	tmpVal   reflect.Value
+	ticks    []uint64
+	items    reflect.Value
 }
 
+// NewTickBuffer creates a buffer with the items encoded in buf, which get
+// the tick 0.
 func NewTickBuffer(dataType reflect.Type, buf []byte) *TickBuffer {
-	buffer := bytes.NewBuffer(buf)
+	n := len(buf) / int(dataType.Size())
 	tb := &TickBuffer{
 		dataType: dataType,
-		buff:     buffer,
+		ticks:    make([]uint64, n),
+		items:    reflect.MakeSlice(reflect.SliceOf(dataType), n, n),
 	}
-
-	tb.tmpVal = reflect.New(tb.dataType)
+	copy(tb.Bytes(), buf)
 
 	return tb
 }
 
-func (b *TickBuffer) ToSlice() interface{} {
-	buff := b.buff.Bytes()
-	ptr := unsafe.Pointer(&buff[0])
-	itemCount := len(b.buff.Bytes()) / int(b.dataType.Size())
-	sliceHeader := &reflect.SliceHeader{
-		Data: uintptr(ptr),
-		Len:  itemCount,
-		Cap:  itemCount,
+// FromTickFile creates a buffer with the items of the file
+func FromTickFile(tf *TickFile) (*TickBuffer, error) {
+	reader, err := tf.GetTickReader()
+	if err != nil {
+		return nil, err
+	}
+	tb := NewTickBuffer(tf.dataType, nil)
+	for {
+		tick, deltas, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := tb.AppendDeltas(tick, deltas); err != nil {
+			return nil, err
+		}
 	}
-	sliceHeaderPtr := unsafe.Pointer(sliceHeader)
+	return tb, nil
+}
+
+func (b *TickBuffer) DeltaType() reflect.Type {
+	return b.dataType
+}
 
-	sliceTyp := reflect.SliceOf(b.dataType)
-	slice := reflect.NewAt(sliceTyp, sliceHeaderPtr)
+// Slice returns the items as a slice of the data type. The slice shares
+// the memory of the buffer until the next append.
+func (b *TickBuffer) Slice() interface{} {
+	return b.items.Interface()
+}
 
+// ToSlice returns a pointer to the slice returned by Slice
+func (b *TickBuffer) ToSlice() interface{} {
+	slice := reflect.New(b.items.Type())
+	slice.Elem().Set(b.items)
 	return slice.Interface()
 }
 
+// Ticks returns the ticks of the items
+func (b *TickBuffer) Ticks() []uint64 {
+	return b.ticks
+}
+
+// Bytes returns the memory of the items
 func (b *TickBuffer) Bytes() []byte {
-	return b.buff.Bytes()
+	if b.items.Len() == 0 {
+		return nil
+	}
+	return unsafeBytes(unsafe.Pointer(b.items.Pointer()), b.items.Len()*int(b.dataType.Size()))
 }
 
+// Read returns a pointer to the item at idx
 func (b *TickBuffer) Read(idx int) interface{} {
-	ptrIdx := int64(idx) * int64(b.dataType.Size())
-	ptr := unsafe.Pointer(&b.buff.Bytes()[ptrIdx])
-	val := reflect.NewAt(b.dataType, ptr)
-	return val.Interface()
+	return b.items.Index(idx).Addr().Interface()
+}
+
+// Tick returns the tick of the item at idx
+func (b *TickBuffer) Tick(idx int) uint64 {
+	return b.ticks[idx]
 }
 
+// grow adds n zeroed items and returns a pointer to the first one
+func (b *TickBuffer) grow(n int) unsafe.Pointer {
+	l := b.items.Len()
+	if l+n > b.items.Cap() {
+		c := 2 * b.items.Cap()
+		if c < l+n {
+			c = l + n
+		}
+		items := reflect.MakeSlice(b.items.Type(), l, c)
+		reflect.Copy(items, b.items)
+		b.items = items
+	}
+	b.items = b.items.Slice(0, l+n)
+	return unsafe.Pointer(b.items.Index(l).Addr().Pointer())
+}
+
+// Append appends the items of a slice of the data type with the tick.
+func (b *TickBuffer) Append(tick uint64, items interface{}) error {
+	val := reflect.ValueOf(items)
+	if val.Type() != b.items.Type() {
+		return fmt.Errorf("was expecting slice of %s, got %s", b.dataType, val.Type())
+	}
+	if n := len(b.ticks); n > 0 && tick < b.ticks[n-1] {
+		return ErrTickOutOfOrder
+	}
+	b.items = reflect.AppendSlice(b.items, val)
+	for i := 0; i < val.Len(); i++ {
+		b.ticks = append(b.ticks, tick)
+	}
+	return nil
+}
+
+// AppendDeltas appends deltas, as returned by the readers, with the tick.
+func (b *TickBuffer) AppendDeltas(tick uint64, deltas TickDeltas) error {
+	if n := len(b.ticks); n > 0 && tick < b.ticks[n-1] {
+		return ErrTickOutOfOrder
+	}
+	if deltas.Len == 0 {
+		return nil
+	}
+	size := deltas.Len * int(b.dataType.Size())
+	ptr := b.grow(deltas.Len)
+	copy(unsafeBytes(ptr, size), unsafeBytes(deltas.Pointer, size))
+	for i := 0; i < deltas.Len; i++ {
+		b.ticks = append(b.ticks, tick)
+	}
+	return nil
+}
+
+// Write appends the items of a pointer to a slice of the data type, with
+// the tick of the last item.
+//
+// Deprecated: use Append.
 func (b *TickBuffer) Write(val interface{}) (int, error) {
 	expectedType := reflect.PtrTo(reflect.SliceOf(b.dataType))
 
@@ -60,20 +152,59 @@ func (b *TickBuffer) Write(val interface{}) (int, error) {
 		return 0, fmt.Errorf("was expecting pointer to slice of %s, got %s", b.dataType, reflect.TypeOf(val))
 	}
 
-	hdr := (*reflect.SliceHeader)(unsafe.Pointer(reflect.ValueOf(val).Pointer()))
-	size := hdr.Len * int(b.dataType.Size())
-
-	var sl = struct {
-		addr uintptr
-		len  int
-		cap  int
-	}{hdr.Data, size, size}
+	var tick uint64
+	if n := len(b.ticks); n > 0 {
+		tick = b.ticks[n-1]
+	}
+	items := reflect.ValueOf(val).Elem()
+	if err := b.Append(tick, items.Interface()); err != nil {
+		return 0, err
+	}
+	return items.Len() * int(b.dataType.Size()), nil
+}
 
-	p := *(*[]byte)(unsafe.Pointer(&sl))
+func (b *TickBuffer) ItemCount() int {
+	return len(b.ticks)
+}
 
-	return b.buff.Write(p)
+// Range returns the items with a tick in [from, to). The returned buffer
+// shares the memory of the buffer, appending to it does not modify the
+// buffer.
+func (b *TickBuffer) Range(from, to uint64) *TickBuffer {
+	i := sort.Search(len(b.ticks), func(i int) bool {
+		return b.ticks[i] >= from
+	})
+	j := sort.Search(len(b.ticks), func(i int) bool {
+		return b.ticks[i] >= to
+	})
+	if j < i {
+		j = i
+	}
+	return &TickBuffer{
+		dataType: b.dataType,
+		ticks:    b.ticks[i:j:j],
+		items:    b.items.Slice3(i, j, j),
+	}
 }
 
-func (b *TickBuffer) ItemCount() int {
-	return len(b.buff.Bytes()) / int(b.dataType.Size())
+// WriteToTickFile writes the items to the file, one write per tick.
+func (b *TickBuffer) WriteToTickFile(tf *TickFile) error {
+	if tf.dataType != b.dataType {
+		return fmt.Errorf("was expecting file of %s, got %s", b.dataType, tf.dataType)
+	}
+	for i := 0; i < len(b.ticks); {
+		j := i + 1
+		for j < len(b.ticks) && b.ticks[j] == b.ticks[i] {
+			j++
+		}
+		deltas := TickDeltas{
+			Pointer: unsafe.Pointer(b.items.Index(i).Addr().Pointer()),
+			Len:     j - i,
+		}
+		if err := tf.Write(b.ticks[i], deltas); err != nil {
+			return err
+		}
+		i = j
+	}
+	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"unsafe"
 )
 
 func TestTickBuffer_Write(t *testing.T) {
@@ -48,3 +49,91 @@ func TestTickBuffer_WriteByteSlice(t *testing.T) {
 		}
 	}
 }
+
+func TestTickBuffer_Append(t *testing.T) {
+	b := NewTickBuffer(reflect.TypeOf(Data{}), nil)
+	var goldenDeltas []Data
+	for i := 0; i < 100; i++ {
+		items := []Data{{Time: uint64(i), Price: uint32(i)}, {Time: uint64(i), Price: uint32(2 * i)}}
+		if err := b.Append(uint64(i*10), items); err != nil {
+			t.Fatalf("error appending: %v", err)
+		}
+		goldenDeltas = append(goldenDeltas, items...)
+	}
+	if err := b.Append(5, []Data{data1}); err != ErrTickOutOfOrder {
+		t.Fatalf("was expecting out of order error, got %v", err)
+	}
+	if err := b.Append(1000, []float64{1}); err == nil {
+		t.Fatalf("was expecting a type error")
+	}
+	if b.ItemCount() != 200 {
+		t.Fatalf("got different item count: %d", b.ItemCount())
+	}
+	slice := b.Slice().([]Data)
+	if !reflect.DeepEqual(slice, goldenDeltas) {
+		t.Fatalf("got different items")
+	}
+	if *b.Read(3).(*Data) != goldenDeltas[3] || b.Tick(3) != 10 {
+		t.Fatalf("got different item")
+	}
+
+	r := b.Range(100, 200)
+	if r.ItemCount() != 20 || r.Tick(0) != 100 || r.Tick(19) != 190 {
+		t.Fatalf("got different range: %v", r.Ticks())
+	}
+	if !reflect.DeepEqual(r.Slice().([]Data), goldenDeltas[20:40]) {
+		t.Fatalf("got different range items")
+	}
+	// Appending to a range does not modify the buffer
+	if err := r.Append(190, []Data{data1}); err != nil {
+		t.Fatal(err)
+	}
+	if b.Slice().([]Data)[40] != goldenDeltas[40] {
+		t.Fatalf("range append modified the buffer")
+	}
+	if b.Range(2000, 3000).ItemCount() != 0 || b.Range(200, 100).ItemCount() != 0 {
+		t.Fatalf("was expecting empty ranges")
+	}
+}
+
+func TestTickBuffer_TickFile(t *testing.T) {
+	for _, configs := range [][]TickFileConfig{nil, {WithColumnarLayout(16)}} {
+		b := NewTickBuffer(reflect.TypeOf(Data{}), nil)
+		for i := 0; i < 1000; i++ {
+			delta := Data{Time: uint64(i), Price: uint32(i * 7), Prib: uint64(i % 3)}
+			if err := b.AppendDeltas(uint64(i/3), TickDeltas{Pointer: unsafe.Pointer(&delta), Len: 1}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		file, err := fs.Create("tickbuffer.tick")
+		if err != nil {
+			t.Fatalf("error creating file")
+		}
+		tf, err := Create(file, append([]TickFileConfig{WithDataType(reflect.TypeOf(Data{}))}, configs...)...)
+		if err != nil {
+			t.Fatalf("error creating tickfile: %v", err)
+		}
+		if err := b.WriteToTickFile(tf); err != nil {
+			t.Fatalf("error writing to tickfile: %v", err)
+		}
+		if err := tf.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening tickfile: %v", err)
+		}
+		b2, err := FromTickFile(tf)
+		if err != nil {
+			t.Fatalf("error reading tickfile: %v", err)
+		}
+		if !reflect.DeepEqual(b.Ticks(), b2.Ticks()) {
+			t.Fatalf("got different ticks")
+		}
+		if !reflect.DeepEqual(b.Slice(), b2.Slice()) {
+			t.Fatalf("got different items")
+		}
+	}
+}
@@ -1,13 +1,16 @@
 package gotickfile
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"github.com/melaurent/gotickfile/v2/compress"
 	"github.com/melaurent/kafero"
 	"io"
-	"io/ioutil"
 	"reflect"
+	"sync"
+	"time"
 	"unsafe"
 )
 
@@ -19,8 +22,16 @@ import (
 // to the file content so it can return pointer to delta without copy
 // So file handle and file system
 
+const (
+	magicValue   = 0x0d0e0a0402080502
+	magicValueV1 = 0x0d0e0a0402080500
+)
+
 var nativeEndian binary.ByteOrder
 
+// The byte order opposite to the native one
+var swappedEndian binary.ByteOrder
+
 var ErrCorruptedBlock = fmt.Errorf("corrupted block")
 
 func init() {
@@ -30,13 +41,19 @@ func init() {
 	switch buf {
 	case [2]byte{0xCD, 0xAB}:
 		nativeEndian = binary.LittleEndian
+		swappedEndian = binary.BigEndian
 	case [2]byte{0xAB, 0xCD}:
 		nativeEndian = binary.BigEndian
+		swappedEndian = binary.LittleEndian
 	default:
 		panic("could not determine native endianness.")
 	}
 }
 
+// TickDeltas are the items of a tick, Len consecutive values of the delta
+// type at Pointer. The deltas returned by a reader point into memory owned
+// by the reader: they are overwritten by the next call, or left behind when
+// the reader grows its buffer. Use WithCopy or NextInto to keep them.
 type TickDeltas struct {
 	Pointer unsafe.Pointer
 	Len     int
@@ -49,33 +66,61 @@ type Header struct {
 }
 
 type TickFile struct {
-	file                      kafero.File
-	offset                    int64
-	write                     bool
-	writer                    *CTickWriter
-	lastTick                  uint64
-	lastWrite                 int
-	block                     *compress.BBuffer
-	dataType                  reflect.Type
-	header                    Header
+	sync.Mutex
+	file      tickFileIO
+	offset    int64
+	write     bool
+	writer    *CTickWriter
+	lastTick  uint64
+	lastWrite int
+	block     *compress.BBuffer
+	mmap      []byte
+	// Offset in the data area of the first byte of block, the data
+	// before is read on the first access to all the data
+	dataBase int64
+	guard    *mapGuard
+	dataType reflect.Type
+	header   Header
+	// Byte order of the header, the sections and the fields stored
+	// without compression
+	order                     binary.ByteOrder
 	itemSection               *ItemSection
+	blockSection              *BlockSection
+	checkpointSection         *CheckpointSection
 	nameValueSection          *NameValueSection
 	tagsSection               *TagsSection
 	contentDescriptionSection *ContentDescriptionSection
+	blocks                    *columnBlocks
+	bwriter                   *blockWriter
+	flushedBlocks             int
+	flushedTail               int
+	flushedEncoding           []byte
+	checkpoint                bool
+	checkpointOffset          int64
+	itemIndexSection          *ItemIndexSection
+	itemIndexOffset           int64
+	indexed                   bool
+	itemCount                 uint64
+	itemIndex                 itemIndex
+	reorder                   *reorderBuffer
+	observer                  Observer
+	autoFlush                 *autoFlush
 	tmpVal                    reflect.Value
 }
 
 func Create(file kafero.File, configs ...TickFileConfig) (*TickFile, error) {
-	var tf *TickFile
-
 	if err := file.Truncate(0); err != nil {
 		return nil, fmt.Errorf("error truncating file: %w", err)
 	}
+	return create(file, configs...)
+}
 
-	tf = &TickFile{
+func create(file tickFileIO, configs ...TickFileConfig) (*TickFile, error) {
+	tf := &TickFile{
 		file:   file,
 		write:  true,
 		writer: nil,
+		order:  nativeEndian,
 	}
 
 	for _, config := range configs {
@@ -84,9 +129,14 @@ func Create(file kafero.File, configs ...TickFileConfig) (*TickFile, error) {
 	if tf.dataType == nil {
 		return nil, fmt.Errorf("no data type")
 	}
+	if tf.reorder != nil {
+		if err := tf.reorder.check(tf.dataType); err != nil {
+			return nil, err
+		}
+	}
 	tf.header.SectionCount = 0
 	tf.header.ItemStart = int64(reflect.TypeOf(tf.header).Size())
-	tf.header.MagicValue = 0x0d0e0a0402080502
+	tf.header.MagicValue = magicValue
 
 	if tf.itemSection != nil {
 		err := tf.checkDataType()
@@ -103,6 +153,46 @@ func Create(file kafero.File, configs ...TickFileConfig) (*TickFile, error) {
 		tf.header.ItemStart += tf.itemSection.Size()
 	}
 
+	if tf.blockSection != nil {
+		if tf.itemSection == nil {
+			return nil, fmt.Errorf("block layout requires an item section")
+		}
+		if tf.blockSection.Layout != COLUMNAR_LAYOUT {
+			return nil, fmt.Errorf("block compression requires the columnar layout")
+		}
+		tf.header.SectionCount += 1
+		// Section ID
+		tf.header.ItemStart += 4
+		// Next Section Offset
+		tf.header.ItemStart += 4
+		// Block Section
+		tf.header.ItemStart += tf.blockSection.Size()
+	}
+
+	if tf.itemSection != nil && tf.blockSection == nil && tf.checkpoint {
+		tf.checkpointSection = &CheckpointSection{
+			State: make([]byte, tf.itemSection.stateSize()),
+		}
+		tf.header.SectionCount += 1
+		// Section ID
+		tf.header.ItemStart += 4
+		// Next Section Offset
+		tf.header.ItemStart += 4
+		// Checkpoint Section
+		tf.header.ItemStart += tf.checkpointSection.Size()
+	}
+
+	if tf.itemSection != nil && tf.blockSection == nil && tf.indexed {
+		tf.itemIndexSection = &ItemIndexSection{}
+		tf.header.SectionCount += 1
+		// Section ID
+		tf.header.ItemStart += 4
+		// Next Section Offset
+		tf.header.ItemStart += 4
+		// Item Index Section
+		tf.header.ItemStart += tf.itemIndexSection.Size()
+	}
+
 	if tf.nameValueSection != nil {
 		tf.header.SectionCount += 1
 		// Section ID
@@ -145,12 +235,19 @@ func Create(file kafero.File, configs ...TickFileConfig) (*TickFile, error) {
 	tf.tmpVal = reflect.New(tf.dataType)
 	tf.lastTick = 0
 	tf.block = compress.NewBBuffer(nil, 0)
+	if tf.blockSection != nil {
+		tf.blocks = &columnBlocks{}
+	} else {
+		// The writer extends the item index from the beginning
+		tf.itemIndex.entries = []itemIndexEntry{{}}
+	}
 	tf.lastWrite = 0
 	if _, err := tf.file.Seek(tf.header.ItemStart, io.SeekStart); err != nil {
 		return nil, err
 	}
 	tf.offset = tf.header.ItemStart
 
+	tf.startAutoFlush()
 	return tf, nil
 }
 
@@ -178,17 +275,34 @@ func (tf *TickFile) GetContentDescription() *string {
 	}
 }
 
+// GetFile returns the file, or nil for a file held in memory
 func (tf *TickFile) GetFile() kafero.File {
-	return tf.file
+	file, _ := tf.file.(kafero.File)
+	return file
 }
 
-func OpenWrite(file kafero.File, dataType reflect.Type) (*TickFile, error) {
+// OpenWrite opens a file to append to it. The configs can set writer
+// options such as WithReorderWindow, the sections are read from the file.
+func OpenWrite(file kafero.File, dataType reflect.Type, configs ...TickFileConfig) (*TickFile, error) {
 	tf := &TickFile{
 		file:     file,
 		write:    true,
 		writer:   nil,
 		dataType: dataType,
 	}
+	// Only the writer options are taken from the configs
+	opts := &TickFile{}
+	for _, config := range configs {
+		config(opts)
+	}
+	tf.reorder = opts.reorder
+	tf.observer = opts.observer
+	tf.autoFlush = opts.autoFlush
+	if tf.reorder != nil {
+		if err := tf.reorder.check(dataType); err != nil {
+			return nil, err
+		}
+	}
 
 	if _, err := tf.file.Seek(0, io.SeekStart); err != nil {
 		return nil, fmt.Errorf("error seeking to beginning of file: %w", err)
@@ -197,75 +311,79 @@ func OpenWrite(file kafero.File, dataType reflect.Type) (*TickFile, error) {
 	if err := tf.readHeader(); err != nil {
 		return nil, err
 	}
+	if tf.order != nativeEndian {
+		return nil, ErrForeignByteOrder
+	}
 
 	if err := tf.checkDataType(); err != nil {
 		return nil, err
 	}
 
-	if _, err := tf.file.Seek(tf.header.ItemStart, io.SeekStart); err != nil {
-		return nil, err
-	}
 	tf.offset = tf.header.ItemStart
 
-	block, err := ioutil.ReadAll(tf.file)
+	block, err := tf.readTail(context.Background())
 	if err != nil {
 		return nil, err
 	}
 
-	tf.offset += int64(len(block))
+	if tf.blockSection != nil {
+		if err := tf.openWriteBlocks(block); err != nil {
+			return nil, err
+		}
+		tf.tmpVal = reflect.New(tf.dataType)
+		tf.startAutoFlush()
+		return tf, nil
+	}
+
+	block, _ = tf.readItemIndex(block)
+	tf.offset += tf.dataBase + int64(len(block))
 	tf.lastWrite = len(block)
 
 	if len(block) == 0 {
 		tf.block = compress.NewBBuffer(nil, 0)
 		tf.lastTick = 0
+		tf.itemIndex.entries = []itemIndexEntry{{}}
 	} else {
 		// Create buffer from block
 		tf.block, err = blockToBuffer(block)
 		if err != nil {
 			return nil, err
 		}
-		// Read to the end
-		w, lastTick, err := CTickWriterFromBlock(tf.block, tf.itemSection, tf.dataType)
-		if err != nil {
-			return nil, fmt.Errorf("error loading writer from block: %w", err)
+		var w *CTickWriter
+		var lastTick, itemCount uint64
+		// The block ends with the EOF value
+		if tf.validCheckpoint(tf.dataBits() - 5) {
+			w, lastTick, itemCount, err = tf.ctickWriterFromCheckpoint()
+			if err != nil {
+				return nil, fmt.Errorf("error loading writer from checkpoint: %w", err)
+			}
+		} else {
+			if err := tf.loadData(); err != nil {
+				return nil, err
+			}
+			// Read to the end
+			w, lastTick, itemCount, err = ctickWriterFromBlock(tf.block, tf.itemSection, tf.dataType)
+			if err != nil {
+				return nil, fmt.Errorf("error loading writer from block: %w", err)
+			}
 		}
+		tf.lastTick = lastTick
+		tf.itemCount = itemCount
 		// Open block
 		if err := w.Open(tf.block); err != nil {
 			return nil, fmt.Errorf("error opening block for writing: %w", err)
 		}
 		tf.writer = w
-		tf.lastTick = lastTick
 	}
 
 	tf.tmpVal = reflect.New(tf.dataType)
+	tf.startAutoFlush()
 	return tf, nil
 }
 
 func blockToBuffer(block []byte) (*compress.BBuffer, error) {
-	// Look for EOF value in block
-	// look in the last byte
-	// XXX11111 -> count = 0
-	// XX111110 -> count = 1
-	// X1111100 -> count = 2
-	// 11111000 -> count = 3
-	// XXXXXXX1 11110000 -> count = 4
-	// XXXXXX11 11100000 -> count = 5
-	// XXXXX111 11000000 -> count = 6
-	// XXXX1111 10000000 -> count = 7
-	var v uint16
-	N := len(block)
-	if N > 1 {
-		v = uint16(block[N-2])<<8 | uint16(block[N-1])
-	} else {
-		v = uint16(block[N-1])
-	}
-
-	var count uint8 = 0
-	for v != 0 && v&0x1F != 0x1F {
-		v >>= 1
-		count += 1
-	}
-	if v == 0 {
+	count, ok := compress.EndCount(block)
+	if !ok {
 		buf := compress.NewBBuffer(block, 0)
 		return buf, ErrCorruptedBlock
 	} else {
@@ -292,8 +410,25 @@ func (tf *TickFile) Write(tick uint64, val TickDeltas) error {
 		}
 	*/
 
+	tf.Lock()
+	defer tf.Unlock()
+
+	if tf.reorder != nil {
+		if err := tf.reorder.write(tf, tick, val); err != nil {
+			return err
+		}
+	} else if err := tf.writeDeltas(tick, val); err != nil {
+		return err
+	}
+	if tf.autoFlush != nil {
+		tf.autoFlush.check(tf)
+	}
+	return nil
+}
+
+func (tf *TickFile) writeDeltas(tick uint64, val TickDeltas) error {
 	if tick < tf.lastTick {
-		fmt.Println("TF OUT OF ORDER", tick, tf.lastTick)
+		tf.observe().OnOutOfOrder(tf.file.Name(), tick, tf.lastTick)
 		return ErrTickOutOfOrder
 	}
 	count := val.Len
@@ -302,13 +437,26 @@ func (tf *TickFile) Write(tick uint64, val TickDeltas) error {
 		return nil
 	}
 
+	if tf.blocks != nil {
+		if err := tf.writeBlocks(tick, val.Pointer, count); err != nil {
+			return err
+		}
+		tf.lastTick = tick
+		tf.itemCount += uint64(count)
+		tf.observe().OnWrite(tf.file.Name(), tick, count)
+		return nil
+	}
+
 	size := tf.dataType.Size()
 	ptr := val.Pointer
+	// Index of the next item
+	idx := tf.itemCount
 	if tf.writer == nil {
 		tf.block.Lock()
 		tf.writer = NewCTickWriter(tf.block, tf.itemSection, tick, ptr)
 		tf.block.Unlock()
 		count -= 1
+		idx += 1
 		if count > 0 {
 			ptr = unsafe.Pointer(uintptr(ptr) + size)
 		}
@@ -316,6 +464,7 @@ func (tf *TickFile) Write(tick uint64, val TickDeltas) error {
 
 	tf.block.Lock()
 	for i := 0; i < count; i++ {
+		tf.indexItem(idx + uint64(i))
 		tf.writer.Write(tf.block, tick, ptr)
 		if i < count-1 {
 			ptr = unsafe.Pointer(uintptr(ptr) + size)
@@ -324,16 +473,143 @@ func (tf *TickFile) Write(tick uint64, val TickDeltas) error {
 	tf.block.Unlock()
 
 	tf.lastTick = tick
+	tf.itemCount += uint64(val.Len)
+	tf.observe().OnWrite(tf.file.Name(), tick, val.Len)
+
+	return nil
+}
+
+// WriteBatch writes many tick groups in one call, group i having
+// groupLens[i] items at tick ticks[i]. Items holds the items of all the
+// groups, one after the other, the group lengths must add up to its
+// length. The batch is checked before anything is written, so an invalid
+// or out of order batch is not written at all.
+func (tf *TickFile) WriteBatch(ticks []uint64, items TickDeltas, groupLens []int) error {
+	if !tf.write {
+		return ErrReadOnly
+	}
+
+	if tf.itemSection == nil {
+		return fmt.Errorf("this file has no item section")
+	}
+
+	if len(ticks) != len(groupLens) {
+		return fmt.Errorf("got %d ticks and %d group lengths", len(ticks), len(groupLens))
+	}
+	total := 0
+	for i, n := range groupLens {
+		if n < 0 {
+			return fmt.Errorf("got negative length %d for group %d", n, i)
+		}
+		total += n
+	}
+	if total != items.Len {
+		return fmt.Errorf("got %d items for groups of %d items", items.Len, total)
+	}
+
+	tf.Lock()
+	defer tf.Unlock()
+	if tf.autoFlush != nil {
+		defer tf.autoFlush.check(tf)
+	}
+
+	size := tf.dataType.Size()
+	// Offset of the first item of the group in items
+	var offset uintptr = 0
+	if tf.reorder != nil {
+		for i, tick := range ticks {
+			if groupLens[i] == 0 {
+				continue
+			}
+			ptr := unsafe.Pointer(uintptr(items.Pointer) + offset)
+			if err := tf.reorder.write(tf, tick, TickDeltas{Pointer: ptr, Len: groupLens[i]}); err != nil {
+				return err
+			}
+			offset += uintptr(groupLens[i]) * size
+		}
+		return nil
+	}
+
+	lastTick := tf.lastTick
+	for _, tick := range ticks {
+		if tick < lastTick {
+			tf.observe().OnOutOfOrder(tf.file.Name(), tick, lastTick)
+			return ErrTickOutOfOrder
+		}
+		lastTick = tick
+	}
+	if total == 0 {
+		return nil
+	}
+
+	if tf.blocks != nil {
+		for i, tick := range ticks {
+			if groupLens[i] == 0 {
+				continue
+			}
+			ptr := unsafe.Pointer(uintptr(items.Pointer) + offset)
+			if err := tf.writeBlocks(tick, ptr, groupLens[i]); err != nil {
+				return err
+			}
+			tf.lastTick = tick
+			tf.itemCount += uint64(groupLens[i])
+			offset += uintptr(groupLens[i]) * size
+			tf.observe().OnWrite(tf.file.Name(), tick, groupLens[i])
+		}
+		return nil
+	}
+
+	tf.block.Lock()
+	idx := tf.itemCount
+	for i, tick := range ticks {
+		for j := 0; j < groupLens[i]; j++ {
+			ptr := unsafe.Pointer(uintptr(items.Pointer) + offset)
+			if tf.writer == nil {
+				tf.writer = NewCTickWriter(tf.block, tf.itemSection, tick, ptr)
+			} else {
+				tf.indexItem(idx)
+				tf.writer.Write(tf.block, tick, ptr)
+			}
+			offset += size
+			idx += 1
+		}
+	}
+	tf.block.Unlock()
+
+	tf.lastTick = lastTick
+	tf.itemCount += uint64(total)
+	for i, tick := range ticks {
+		if groupLens[i] > 0 {
+			tf.observe().OnWrite(tf.file.Name(), tick, groupLens[i])
+		}
+	}
 
 	return nil
 }
 
-func OpenRead(file kafero.File, dataType reflect.Type) (*TickFile, error) {
+// OpenRead opens a file to read it. The configs can set options such as
+// WithObserver, the sections are read from the file.
+func OpenRead(file kafero.File, dataType reflect.Type, configs ...TickFileConfig) (*TickFile, error) {
+	return OpenReadContext(context.Background(), file, dataType, configs...)
+}
+
+// OpenReadContext is like OpenRead, but stops reading and decoding the
+// file when the context is done, returning the context error.
+func OpenReadContext(ctx context.Context, file kafero.File, dataType reflect.Type, configs ...TickFileConfig) (*TickFile, error) {
+	return openRead(ctx, file, dataType, configs...)
+}
+
+func openRead(ctx context.Context, file tickFileIO, dataType reflect.Type, configs ...TickFileConfig) (*TickFile, error) {
 	tf := &TickFile{
 		file:     file,
 		write:    false,
 		dataType: dataType,
 	}
+	opts := &TickFile{}
+	for _, config := range configs {
+		config(opts)
+	}
+	tf.observer = opts.observer
 
 	if _, err := tf.file.Seek(0, 0); err != nil {
 		return nil, fmt.Errorf("error seeking to beginning of file: %w", err)
@@ -352,11 +628,33 @@ func OpenRead(file kafero.File, dataType reflect.Type) (*TickFile, error) {
 	}
 	tf.offset = tf.header.ItemStart
 	// Read file to block
-	block, err := ioutil.ReadAll(tf.file)
+	block, err := tf.readData(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error reading file to block: %w", err)
 	}
-	tf.offset += int64(len(block))
+	if err := tf.openData(ctx, block); err != nil {
+		_ = tf.munmap()
+		return nil, err
+	}
+	return tf, nil
+}
+
+// openData loads the data of a file opened for reading
+func (tf *TickFile) openData(ctx context.Context, block []byte) error {
+	var err error
+	if tf.blockSection != nil {
+		corrupted, _, err := tf.openBlocks(block)
+		if err != nil {
+			return fmt.Errorf("error reading blocks: %w", err)
+		}
+		if corrupted {
+			tf.recovered()
+		}
+		tf.tmpVal = reflect.New(tf.dataType)
+		return nil
+	}
+	block, indexed := tf.readItemIndex(block)
+	tf.offset += tf.dataBase + int64(len(block))
 	tf.lastWrite = len(block)
 	if len(block) == 0 {
 		tf.block = compress.NewBBuffer(nil, 0)
@@ -366,43 +664,71 @@ func OpenRead(file kafero.File, dataType reflect.Type) (*TickFile, error) {
 		corruped := false
 		if err != nil {
 			if err != ErrCorruptedBlock {
-				return nil, err
+				return err
 			} else {
 				corruped = true
 			}
 		}
 		// Open block
 		tf.block.Rewind(5)
+		if !corruped && indexed {
+			// The item count was written when the file was closed
+			tf.lastTick = tf.itemIndexSection.LastTick
+			tf.itemCount = tf.itemIndexSection.ItemCount
+			tf.tmpVal = reflect.New(tf.dataType)
+			return nil
+		}
+		if !corruped && tf.validCheckpoint(tf.dataBits()) {
+			_, lastTick, itemCount, err := tf.ctickWriterFromCheckpoint()
+			if err != nil {
+				return fmt.Errorf("error loading checkpoint: %w", err)
+			}
+			tf.lastTick = lastTick
+			tf.itemCount = itemCount
+			tf.tmpVal = reflect.New(tf.dataType)
+			return nil
+		}
+		if err := tf.loadData(); err != nil {
+			return err
+		}
 		br := compress.NewBitReader(tf.block)
 		tr, err := NewCTickReader(tf.itemSection, tf.dataType, br)
 		if err != nil {
-			return nil, fmt.Errorf("error getting tick reader: %w", err)
+			return fmt.Errorf("error getting tick reader: %w", err)
 		}
 		err = nil
 		var tick uint64 = 0
 		var state compress.BitReaderState
-		for err == nil {
+		var deltas TickDeltas
+		for i := 0; err == nil; i++ {
+			if i%contextCheckInterval == 0 {
+				if cerr := ctx.Err(); cerr != nil {
+					return cerr
+				}
+			}
+			tf.itemCount += uint64(deltas.Len)
 			// save bit reader state before
 			state = br.State()
-			tick, _, err = tr.Next()
+			tick, deltas, err = tr.Next()
 		}
 
 		if err == io.EOF {
 			tf.lastTick = tick
 		} else if err == io.ErrUnexpectedEOF {
 			if !corruped {
-				return nil, err
+				return err
 			} else {
 				// Rewind to state before read error
 				tf.block.RewindTo(state)
 				tf.lastTick = tick
+				tf.recovered()
 			}
 		}
 	}
 
 	tf.tmpVal = reflect.New(tf.dataType)
 
-	return tf, nil
+	return nil
 }
 
 func OpenHeader(file kafero.File) (*TickFile, error) {
@@ -425,18 +751,99 @@ func (tf *TickFile) LastTick() uint64 {
 	return tf.lastTick
 }
 
-func (tf *TickFile) GetTickReader() (*CTickReader, error) {
-	return NewCTickReader(tf.itemSection, tf.dataType, compress.NewBitReader(tf.block))
+func (tf *TickFile) GetTickReader(configs ...TickReaderConfig) (*CTickReader, error) {
+	if tf.guard != nil {
+		if !tf.guard.acquire() {
+			return nil, ErrClosed
+		}
+		tf.guard.RUnlock()
+	}
+	if err := tf.loadData(); err != nil {
+		return nil, err
+	}
+	r, err := NewCTickReader(tf.itemSection, tf.dataType, compress.NewBitReader(tf.block))
+	if err != nil {
+		return nil, err
+	}
+	r.swaps = tf.byteSwaps()
+	r.guard = tf.guard
+	for _, config := range configs {
+		config(r)
+	}
+	if err := r.setupFilters(); err != nil {
+		return nil, err
+	}
+	fields, err := r.columns()
+	if err != nil {
+		return nil, err
+	}
+	if tf.blocks != nil {
+		r.cr = newColumnReader(tf.blocks, tf.itemSection, tf.dataType.Size(), fields)
+		r.cr.skip = r.skipBlock
+	}
+	return r, nil
+}
+
+// GetFieldReader returns a reader that only decodes the given fields in a
+// columnar file, the other fields of the returned items are zeroed. With
+// the stream layout, all the fields are decoded.
+func (tf *TickFile) GetFieldReader(fields ...string) (*CTickReader, error) {
+	if tf.itemSection == nil {
+		return nil, fmt.Errorf("this file has no item section")
+	}
+	return tf.GetTickReader(WithFields(fields...))
 }
 
 func (tf *TickFile) GetChunkReader(chunkSize int) (*compress.ChunkReader, error) {
+	if tf.blocks != nil {
+		return nil, fmt.Errorf("chunk reader not supported with a columnar layout")
+	}
+	if err := tf.loadData(); err != nil {
+		return nil, err
+	}
 	return compress.NewChunkReader(tf.block, chunkSize), nil
 }
 
+// Flush writes the data to the file and syncs it to stable storage.
 func (tf *TickFile) Flush() error {
+	tf.Lock()
+	defer tf.Unlock()
+	return tf.flush(true)
+}
+
+// Sync commits the data written to the file by the previous flushes to
+// stable storage.
+func (tf *TickFile) Sync() error {
+	if err := tf.file.Sync(); err != nil {
+		return fmt.Errorf("error syncing file: %w", err)
+	}
+	return nil
+}
+
+func (tf *TickFile) flush(sync bool) error {
+	start := time.Now()
+	if tf.blocks != nil {
+		if !tf.write {
+			return nil
+		}
+		n, err := tf.flushBlocks(sync)
+		if err != nil {
+			return err
+		}
+		if sync {
+			if err := tf.file.Sync(); err != nil {
+				return fmt.Errorf("error syncing file")
+			}
+		}
+		tf.observe().OnFlush(tf.file.Name(), n, time.Since(start))
+		return nil
+	}
 	if tf.writer == nil {
 		return nil
 	}
+	if err := tf.dropItemIndex(); err != nil {
+		return err
+	}
 
 	// Flush to disk
 	if tf.offset-tf.header.ItemStart > 2 {
@@ -469,75 +876,147 @@ func (tf *TickFile) Flush() error {
 
 	tf.block.Unlock()
 
-	if err := tf.file.Sync(); err != nil {
-		return fmt.Errorf("error syncing file")
+	if sync {
+		if err := tf.file.Sync(); err != nil {
+			return fmt.Errorf("error syncing file")
+		}
 	}
+	if tf.checkpointSection != nil {
+		if err := tf.writeCheckpoint(false); err != nil {
+			return fmt.Errorf("error writing checkpoint: %w", err)
+		}
+	}
+	tf.observe().OnFlush(tf.file.Name(), n, time.Since(start))
 
 	return nil
 }
 
+// Close stops the auto flush, drains the reorder buffer and flushes the
+// file. It returns the first error of the auto flush, if any. For a file
+// opened for reading, it releases the memory mapping of the file, if any.
 func (tf *TickFile) Close() error {
 	if tf.write {
-		return tf.Flush()
+		var err error
+		if tf.autoFlush != nil {
+			err = tf.autoFlush.stop()
+		}
+		tf.Lock()
+		defer tf.Unlock()
+		if tf.reorder != nil {
+			if err := tf.reorder.drain(tf); err != nil {
+				return err
+			}
+		}
+		if ferr := tf.flush(true); ferr != nil {
+			return ferr
+		}
+		if tf.checkpointSection != nil {
+			if cerr := tf.writeCheckpoint(true); cerr != nil {
+				return fmt.Errorf("error writing checkpoint: %w", cerr)
+			}
+		}
+		if tf.itemIndexSection != nil {
+			if ierr := tf.writeItemIndex(); ierr != nil {
+				return fmt.Errorf("error writing item index: %w", ierr)
+			}
+		}
+		return err
 	} else {
-		return nil
+		return tf.munmap()
 	}
 }
 
 func (tf *TickFile) readHeader() error {
-	err := binary.Read(tf.file, nativeEndian, &tf.header)
-	if err != nil {
+	return tf.readHeaderFrom(tf.file)
+}
+
+// readHeaderFrom reads the header from r, positioned at the beginning of
+// the file
+func (tf *TickFile) readHeaderFrom(r io.Reader) error {
+	cr := &countingReader{r: r}
+	header := make([]byte, binary.Size(tf.header))
+	if _, err := io.ReadFull(cr, header); err != nil {
 		return err
 	}
-	if tf.header.MagicValue != 0x0d0e0a0402080502 {
-		if tf.header.MagicValue == 0x0d0e0a0402080500 {
+	// The magic value is written in the byte order of the file
+	switch uint64(magicValue) {
+	case nativeEndian.Uint64(header):
+		tf.order = nativeEndian
+	case swappedEndian.Uint64(header):
+		tf.order = swappedEndian
+	default:
+		if nativeEndian.Uint64(header) == magicValueV1 || swappedEndian.Uint64(header) == magicValueV1 {
 			return ErrTickFileV1
 		}
 		return fmt.Errorf("byteordermark mismatch")
 	}
+	err := binary.Read(bytes.NewReader(header), tf.order, &tf.header)
+	if err != nil {
+		return err
+	}
 
 	for i := 0; i < int(tf.header.SectionCount); i++ {
 		var sectionID int32
-		err = binary.Read(tf.file, nativeEndian, &sectionID)
+		err = binary.Read(cr, tf.order, &sectionID)
 		if err != nil {
 			return err
 		}
 		var nextSectionOffset int32
-		err = binary.Read(tf.file, nativeEndian, &nextSectionOffset)
+		err = binary.Read(cr, tf.order, &nextSectionOffset)
 		if err != nil {
 			return err
 		}
 
-		beforeSection, err := tf.file.Seek(0, 1)
-		if err != nil {
-			return err
-		}
+		beforeSection := cr.n
 
 		switch sectionID {
 		case ITEM_SECTION_ID:
 			tf.itemSection = &ItemSection{}
-			err = tf.itemSection.Read(tf.file, nativeEndian)
+			err = tf.itemSection.Read(cr, tf.order)
+			if err != nil {
+				return err
+			}
+
+		case BLOCK_SECTION_ID:
+			tf.blockSection = &BlockSection{}
+			err = tf.blockSection.Read(cr, tf.order)
+			if err != nil {
+				return err
+			}
+
+		case CHECKPOINT_SECTION_ID:
+			tf.checkpointSection = &CheckpointSection{}
+			tf.checkpointOffset = beforeSection
+			err = tf.checkpointSection.Read(cr, tf.order)
+			if err != nil {
+				return err
+			}
+
+		case ITEM_INDEX_SECTION_ID:
+			tf.itemIndexSection = &ItemIndexSection{}
+			tf.itemIndexOffset = beforeSection
+			err = tf.itemIndexSection.Read(cr, tf.order)
 			if err != nil {
 				return err
 			}
 
 		case CONTENT_DESCRIPTION_SECTION_ID:
 			tf.contentDescriptionSection = &ContentDescriptionSection{}
-			err = tf.contentDescriptionSection.Read(tf.file, nativeEndian)
+			err = tf.contentDescriptionSection.Read(cr, tf.order)
 			if err != nil {
 				return err
 			}
 
 		case NAME_VALUE_SECTION_ID:
 			tf.nameValueSection = &NameValueSection{}
-			err = tf.nameValueSection.Read(tf.file, nativeEndian)
+			err = tf.nameValueSection.Read(cr, tf.order)
 			if err != nil {
 				return err
 			}
 
 		case TAGS_SECTION_ID:
 			tf.tagsSection = &TagsSection{}
-			err = tf.tagsSection.Read(tf.file, nativeEndian)
+			err = tf.tagsSection.Read(cr, tf.order)
 			if err != nil {
 				return err
 			}
@@ -546,10 +1025,7 @@ func (tf *TickFile) readHeader() error {
 			return fmt.Errorf("unknown section ID %d", sectionID)
 		}
 
-		afterSection, err := tf.file.Seek(0, 1)
-		if err != nil {
-			return err
-		}
+		afterSection := cr.n
 
 		if (afterSection - beforeSection) != int64(nextSectionOffset) {
 			return fmt.Errorf("section reads too few or too many bytes")
@@ -565,7 +1041,7 @@ func (tf *TickFile) writeHeader() error {
 		return err
 	}
 	var currOffset int32 = 0
-	err = binary.Write(tf.file, nativeEndian, tf.header)
+	err = binary.Write(tf.file, tf.order, tf.header)
 	if err != nil {
 		return err
 	}
@@ -573,17 +1049,76 @@ func (tf *TickFile) writeHeader() error {
 
 	if tf.itemSection != nil {
 		sectionSize := int32(tf.itemSection.Size())
-		err = binary.Write(tf.file, nativeEndian, ITEM_SECTION_ID)
+		err = binary.Write(tf.file, tf.order, ITEM_SECTION_ID)
+		if err != nil {
+			return err
+		}
+		currOffset += 4
+		err = binary.Write(tf.file, tf.order, sectionSize)
+		if err != nil {
+			return err
+		}
+		currOffset += 4
+		err = tf.itemSection.Write(tf.file, tf.order)
+		if err != nil {
+			return err
+		}
+		currOffset += sectionSize
+	}
+
+	if tf.blockSection != nil {
+		sectionSize := int32(tf.blockSection.Size())
+		err = binary.Write(tf.file, tf.order, BLOCK_SECTION_ID)
+		if err != nil {
+			return err
+		}
+		currOffset += 4
+		err = binary.Write(tf.file, tf.order, sectionSize)
+		if err != nil {
+			return err
+		}
+		currOffset += 4
+		err = tf.blockSection.Write(tf.file, tf.order)
+		if err != nil {
+			return err
+		}
+		currOffset += sectionSize
+	}
+
+	if tf.checkpointSection != nil {
+		sectionSize := int32(tf.checkpointSection.Size())
+		err = binary.Write(tf.file, tf.order, CHECKPOINT_SECTION_ID)
+		if err != nil {
+			return err
+		}
+		currOffset += 4
+		err = binary.Write(tf.file, tf.order, sectionSize)
+		if err != nil {
+			return err
+		}
+		currOffset += 4
+		tf.checkpointOffset = int64(currOffset)
+		err = tf.checkpointSection.Write(tf.file, tf.order)
+		if err != nil {
+			return err
+		}
+		currOffset += sectionSize
+	}
+
+	if tf.itemIndexSection != nil {
+		sectionSize := int32(tf.itemIndexSection.Size())
+		err = binary.Write(tf.file, tf.order, ITEM_INDEX_SECTION_ID)
 		if err != nil {
 			return err
 		}
 		currOffset += 4
-		err = binary.Write(tf.file, nativeEndian, sectionSize)
+		err = binary.Write(tf.file, tf.order, sectionSize)
 		if err != nil {
 			return err
 		}
 		currOffset += 4
-		err = tf.itemSection.Write(tf.file, nativeEndian)
+		tf.itemIndexOffset = int64(currOffset)
+		err = tf.itemIndexSection.Write(tf.file, tf.order)
 		if err != nil {
 			return err
 		}
@@ -592,17 +1127,17 @@ func (tf *TickFile) writeHeader() error {
 
 	if tf.contentDescriptionSection != nil {
 		sectionSize := int32(tf.contentDescriptionSection.Size())
-		err = binary.Write(tf.file, nativeEndian, CONTENT_DESCRIPTION_SECTION_ID)
+		err = binary.Write(tf.file, tf.order, CONTENT_DESCRIPTION_SECTION_ID)
 		if err != nil {
 			return err
 		}
 		currOffset += 4
-		err = binary.Write(tf.file, nativeEndian, sectionSize)
+		err = binary.Write(tf.file, tf.order, sectionSize)
 		if err != nil {
 			return err
 		}
 		currOffset += 4
-		err = tf.contentDescriptionSection.Write(tf.file, nativeEndian)
+		err = tf.contentDescriptionSection.Write(tf.file, tf.order)
 		if err != nil {
 			return err
 		}
@@ -611,17 +1146,17 @@ func (tf *TickFile) writeHeader() error {
 
 	if tf.nameValueSection != nil {
 		sectionSize := int32(tf.nameValueSection.Size())
-		err = binary.Write(tf.file, nativeEndian, NAME_VALUE_SECTION_ID)
+		err = binary.Write(tf.file, tf.order, NAME_VALUE_SECTION_ID)
 		if err != nil {
 			return err
 		}
 		currOffset += 4
-		err = binary.Write(tf.file, nativeEndian, sectionSize)
+		err = binary.Write(tf.file, tf.order, sectionSize)
 		if err != nil {
 			return err
 		}
 		currOffset += 4
-		err = tf.nameValueSection.Write(tf.file, nativeEndian)
+		err = tf.nameValueSection.Write(tf.file, tf.order)
 		if err != nil {
 			return err
 		}
@@ -630,17 +1165,17 @@ func (tf *TickFile) writeHeader() error {
 
 	if tf.tagsSection != nil {
 		sectionSize := int32(tf.tagsSection.Size())
-		err = binary.Write(tf.file, nativeEndian, TAGS_SECTION_ID)
+		err = binary.Write(tf.file, tf.order, TAGS_SECTION_ID)
 		if err != nil {
 			return err
 		}
 		currOffset += 4
-		err = binary.Write(tf.file, nativeEndian, sectionSize)
+		err = binary.Write(tf.file, tf.order, sectionSize)
 		if err != nil {
 			return err
 		}
 		currOffset += 4
-		err = tf.tagsSection.Write(tf.file, nativeEndian)
+		err = tf.tagsSection.Write(tf.file, tf.order)
 		if err != nil {
 			return err
 		}
@@ -649,7 +1184,7 @@ func (tf *TickFile) writeHeader() error {
 
 	var paddingByte uint8 = 0
 	for int64(currOffset) != tf.header.ItemStart {
-		err = binary.Write(tf.file, nativeEndian, paddingByte)
+		err = binary.Write(tf.file, tf.order, paddingByte)
 		if err != nil {
 			return err
 		}
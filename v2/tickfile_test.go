@@ -1216,3 +1216,92 @@ func BenchmarkConcurrent(b *testing.B) {
 
 	}
 }
+
+func TestWriteBatch(t *testing.T) {
+	for _, configs := range [][]TickFileConfig{nil, {WithColumnarLayout(16)}} {
+		file, err := fs.Create("batch.tick")
+		if err != nil {
+			t.Fatalf("error creating file")
+		}
+		tf, err := Create(file, append([]TickFileConfig{WithDataType(reflect.TypeOf(Data{}))}, configs...)...)
+		if err != nil {
+			t.Fatalf("error creating tickfile: %v", err)
+		}
+
+		var ticks []uint64
+		var goldenDeltas []Data
+		for k := 0; k < 10; k++ {
+			var batchTicks []uint64
+			var groupLens []int
+			var items []Data
+			for i := 0; i < 50; i++ {
+				tick := uint64(k*100 + i*2)
+				n := rand.Intn(3) + 1
+				batchTicks = append(batchTicks, tick)
+				groupLens = append(groupLens, n)
+				for j := 0; j < n; j++ {
+					delta := Data{Time: tick, Price: uint32(j), Prib: uint64(rand.Int())}
+					items = append(items, delta)
+					ticks = append(ticks, tick)
+					goldenDeltas = append(goldenDeltas, delta)
+				}
+			}
+			if err := tf.WriteBatch(batchTicks, TickDeltas{Pointer: unsafe.Pointer(&items[0]), Len: len(items)}, groupLens); err != nil {
+				t.Fatalf("error writing batch: %v", err)
+			}
+		}
+		// Out of order batches are not written
+		if err := tf.WriteBatch([]uint64{2000, 10}, TickDeltas{Pointer: unsafe.Pointer(&[]Data{data1, data2}[0]), Len: 2}, []int{1, 1}); err != ErrTickOutOfOrder {
+			t.Fatalf("was expecting out of order error, got %v", err)
+		}
+		if err := tf.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		tf, err = OpenRead(file, reflect.TypeOf(Data{}))
+		if err != nil {
+			t.Fatalf("error opening tickfile: %v", err)
+		}
+		reader, err := tf.GetTickReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReader(t, reader, ticks, goldenDeltas, func(d Data) Data { return d })
+	}
+}
+
+func TestWriteBatchInvalid(t *testing.T) {
+	items := []Data{data1, data2, data1}
+	tests := []struct {
+		name      string
+		ticks     []uint64
+		len       int
+		groupLens []int
+	}{
+		{"negative length", []uint64{1, 2, 3}, 3, []int{2, 2, -1}},
+		{"negative length with a matching sum", []uint64{1, 2}, 1, []int{2, -1}},
+		{"fewer items than the groups", []uint64{1, 2}, 2, []int{1, 2}},
+		{"more items than the groups", []uint64{1, 2}, 3, []int{1, 1}},
+	}
+	for _, configs := range [][]TickFileConfig{nil, {WithColumnarLayout(16)}, {WithReorderWindow(10)}} {
+		for _, test := range tests {
+			file, err := fs.Create("batch.tick")
+			if err != nil {
+				t.Fatalf("error creating file")
+			}
+			tf, err := Create(file, append([]TickFileConfig{WithDataType(reflect.TypeOf(Data{}))}, configs...)...)
+			if err != nil {
+				t.Fatalf("error creating tickfile: %v", err)
+			}
+			if err := tf.WriteBatch(test.ticks, TickDeltas{Pointer: unsafe.Pointer(&items[0]), Len: test.len}, test.groupLens); err == nil {
+				t.Fatalf("%s: was expecting an error", test.name)
+			}
+			if err := tf.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if tf.ItemCount() != 0 {
+				t.Fatalf("%s: was expecting nothing to be written, got %d items", test.name, tf.ItemCount())
+			}
+		}
+	}
+}
@@ -46,6 +46,11 @@ func textSize(text string) int64 {
 	return 4 + int64(len([]byte(text)))
 }
 
+// unsafeBytes returns a slice over the n bytes at ptr
+func unsafeBytes(ptr unsafe.Pointer, n int) []byte {
+	return (*[1 << 30]byte)(ptr)[:n:n]
+}
+
 func V1ToV2(dst kafero.File, src kafero.File, typ reflect.Type) error {
 	tfv1, err := gotickfilev1.OpenRead(src, typ)
 	if err != nil {
@@ -70,20 +75,19 @@ func V1ToV2(dst kafero.File, src kafero.File, typ reflect.Type) error {
 		_ = tfv1.Close()
 		return fmt.Errorf("error creating tickfile v2: %w", err)
 	}
-	N := tfv1.ItemCount()
-	for i := 0; i < N; i++ {
-		tick, delta, err := tfv1.ReadItem(i)
+	// Items with the same tick are written in one call
+	reader := &v1Reader{tf: tfv1, typ: typ}
+	for {
+		tick, deltas, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
 			_ = tfv1.Close()
 			_ = tfv2.Close()
 			return fmt.Errorf("error reading tickfile v1: %w", err)
 		}
-
-		ptr := unsafe.Pointer(reflect.ValueOf(delta).Pointer())
-		if err := tfv2.Write(tick, TickDeltas{
-			Pointer: ptr,
-			Len:     1,
-		}); err != nil {
+		if err := tfv2.Write(tick, deltas); err != nil {
 			_ = tfv1.Close()
 			_ = tfv2.Close()
 			return fmt.Errorf("error copying to tickfile v2: %w", err)
@@ -23,15 +23,22 @@ func NewCTickWriter(bw *compress.BBuffer, info *ItemSection, tick uint64, ptr un
 }
 
 func CTickWriterFromBlock(bw *compress.BBuffer, info *ItemSection, typ reflect.Type) (*CTickWriter, uint64, error) {
+	w, lastTick, _, err := ctickWriterFromBlock(bw, info, typ)
+	return w, lastTick, err
+}
+
+// ctickWriterFromBlock also returns the number of items in the block
+func ctickWriterFromBlock(bw *compress.BBuffer, info *ItemSection, typ reflect.Type) (*CTickWriter, uint64, uint64, error) {
 	var lastTick uint64
+	var itemCount uint64 = 1
 	br := compress.NewBitReader(bw)
 	tickDec, tick, err := compress.NewTickDecompress(br)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, 0, err
 	}
 	structDec, _, err := NewStructDecompress(br, info, typ)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, 0, err
 	}
 	lastTick = tick
 	for {
@@ -40,14 +47,16 @@ func CTickWriterFromBlock(bw *compress.BBuffer, info *ItemSection, typ reflect.T
 			if err == io.EOF {
 				break
 			} else {
-				return nil, 0, err
+				return nil, 0, 0, err
 			}
 		}
 		lastTick = tick
 		_, err = structDec.Decompress(br)
 		if err != nil {
-			return nil, 0, err
+			return nil, 0, 0, err
 		}
+		structDec.Clear()
+		itemCount += 1
 	}
 	// Now we have a decompressor with the correct state. We have to rewind the last bits used to indicate EOF
 
@@ -57,7 +66,7 @@ func CTickWriterFromBlock(bw *compress.BBuffer, info *ItemSection, typ reflect.T
 	return &CTickWriter{
 		tickC:   tickC,
 		structC: structC,
-	}, lastTick, nil
+	}, lastTick, itemCount, nil
 }
 
 func (w *CTickWriter) Write(bw *compress.BBuffer, tick uint64, ptr unsafe.Pointer) {